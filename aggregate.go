@@ -0,0 +1,216 @@
+package ipset
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// Aggregate returns the shortest list of hash:net entries matching the same
+// addresses as entries: overlapping and adjacent networks are merged and
+// nomatch entries are kept, or added, only where they carve addresses out of
+// an enclosing network. Like the kernel, the most specific network of an
+// address decides whether it matches, and of equal networks the last one.
+// Entries keep their options where their network is kept.
+func Aggregate(entries []Entry) ([]Entry, error) {
+	roots := map[int]*prefixNode{}
+	for i := range entries {
+		e := &entries[i]
+		r, ok := entryRange(e)
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %s", e.Elem(TypeHashNet))
+		}
+		for _, p := range r.prefixes() {
+			root := roots[p.Addr().BitLen()]
+			if root == nil {
+				root = &prefixNode{prefix: netip.PrefixFrom(netip.IPv6Unspecified(), 0), label: labelNone}
+				if p.Addr().Is4() {
+					root.prefix = netip.PrefixFrom(netip.IPv4Unspecified(), 0)
+				}
+				roots[p.Addr().BitLen()] = root
+			}
+			label := labelMatch
+			if e.NoMatch {
+				label = labelNoMatch
+			}
+			root.insert(p, label)
+		}
+	}
+
+	known := make(map[string]*Entry, len(entries))
+	for i := range entries {
+		e := &entries[i]
+		known[fmt.Sprint(e.Elem(TypeHashNet), e.NoMatch)] = e
+	}
+
+	var result []Entry
+	for _, bits := range []int{32, 128} {
+		root := roots[bits]
+		if root == nil {
+			continue
+		}
+		// Optimal Routing Table Constructor, with match and nomatch as
+		// next hops and nomatch as the default route
+		root.normalize(labelNoMatch)
+		root.merge()
+		var chosen []netip.Prefix
+		labels := map[netip.Prefix]int8{}
+		root.choose(labelNoMatch, func(p netip.Prefix, label int8) {
+			chosen = append(chosen, p)
+			labels[p] = label
+		})
+		for _, p := range splitZero(chosen, labels) {
+			e := prefixEntry(p)
+			e.NoMatch = labels[p] == labelNoMatch
+			if k, ok := known[fmt.Sprint(e.Elem(TypeHashNet), e.NoMatch)]; ok {
+				e = *k
+			}
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// splitZero replaces a /0 in chosen, which cannot be stored, by its two
+// halves, unless the halves were chosen themselves.
+func splitZero(chosen []netip.Prefix, labels map[netip.Prefix]int8) []netip.Prefix {
+	if len(chosen) == 0 || chosen[0].Bits() != 0 {
+		return chosen
+	}
+	zero := chosen[0]
+	r := prefixRange(zero)
+	result := make([]netip.Prefix, 0, len(chosen)+1)
+	for _, half := range (addrRange{r.from, r.to}).prefixes() {
+		if _, ok := labels[half]; !ok {
+			labels[half] = labels[zero]
+			result = append(result, half)
+		}
+	}
+	return append(result, chosen[1:]...)
+}
+
+const (
+	labelNone    = int8(-1)
+	labelNoMatch = int8(0)
+	labelMatch   = int8(1)
+)
+
+// prefixNode is a node of a binary trie of networks.
+type prefixNode struct {
+	prefix   netip.Prefix
+	children [2]*prefixNode
+	label    int8  // the label of the network, if it is in the trie
+	labels   uint8 // the candidate labels, a bit per label
+}
+
+func (n *prefixNode) child(i int) *prefixNode {
+	if n.children[i] == nil {
+		addr := n.prefix.Addr().AsSlice()
+		if i == 1 {
+			bit := n.prefix.Bits()
+			addr[bit/8] |= 0x80 >> (bit % 8)
+		}
+		a, _ := netip.AddrFromSlice(addr)
+		n.children[i] = &prefixNode{prefix: netip.PrefixFrom(a, n.prefix.Bits()+1), label: labelNone}
+	}
+	return n.children[i]
+}
+
+func (n *prefixNode) insert(p netip.Prefix, label int8) {
+	addr := p.Addr().AsSlice()
+	for n.prefix.Bits() < p.Bits() {
+		bit := n.prefix.Bits()
+		n = n.child(int(addr[bit/8]>>(7-bit%8)) & 1)
+	}
+	n.label = label
+}
+
+// normalize gives each node no or two children, and each leaf the label of
+// its closest labelled ancestor.
+func (n *prefixNode) normalize(inherited int8) {
+	if n.label != labelNone {
+		inherited = n.label
+	}
+	if n.children[0] == nil && n.children[1] == nil {
+		n.label = inherited
+		return
+	}
+	for i := range n.children {
+		n.child(i).normalize(inherited)
+	}
+}
+
+// merge computes the candidate labels bottom up.
+func (n *prefixNode) merge() {
+	if n.children[0] == nil {
+		n.labels = 1 << uint(n.label)
+		return
+	}
+	n.children[0].merge()
+	n.children[1].merge()
+	if both := n.children[0].labels & n.children[1].labels; both != 0 {
+		n.labels = both
+	} else {
+		n.labels = n.children[0].labels | n.children[1].labels
+	}
+}
+
+// choose emits the networks whose label differs from the one they inherit.
+func (n *prefixNode) choose(inherited int8, emit func(netip.Prefix, int8)) {
+	if n.labels&(1<<uint(inherited)) == 0 {
+		inherited = labelNoMatch
+		if n.labels&(1<<uint(labelMatch)) != 0 {
+			inherited = labelMatch
+		}
+		emit(n.prefix, inherited)
+	}
+	if n.children[0] != nil {
+		n.children[0].choose(inherited, emit)
+		n.children[1].choose(inherited, emit)
+	}
+}
+
+// Overlap is an entry whose addresses are also those of another.
+type Overlap struct {
+	Entry Entry
+	By    Entry // the first entry, in address order, overlapping Entry
+}
+
+// Overlaps returns the hash:net entries overlapping an entry before them in
+// address order, such as the networks inside another one.
+func Overlaps(entries []Entry) ([]Overlap, error) {
+	type item struct {
+		r addrRange
+		e *Entry
+	}
+	items := make([]item, len(entries))
+	for i := range entries {
+		r, ok := entryRange(&entries[i])
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %s", entries[i].Elem(TypeHashNet))
+		}
+		items[i] = item{r, &entries[i]}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if c := items[i].r.from.Compare(items[j].r.from); c != 0 {
+			return c < 0
+		}
+		return items[i].r.to.Compare(items[j].r.to) > 0
+	})
+
+	var (
+		result []Overlap
+		widest *item
+	)
+	for i := range items {
+		it := &items[i]
+		if widest != nil && widest.r.to.BitLen() == it.r.from.BitLen() && it.r.from.Compare(widest.r.to) <= 0 {
+			result = append(result, Overlap{Entry: *it.e, By: *widest.e})
+			if it.r.to.Compare(widest.r.to) <= 0 {
+				continue
+			}
+		}
+		widest = it
+	}
+	return result, nil
+}
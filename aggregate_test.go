@@ -0,0 +1,139 @@
+package ipset
+
+import (
+	"math/rand"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// matches reports whether addr matches entries as in a hash:net set: the
+// most specific network decides, of equal networks the last one.
+func matches(entries []Entry, addr netip.Addr) bool {
+	bits, match := -1, false
+	for i := range entries {
+		r, _ := entryRange(&entries[i])
+		for _, p := range r.prefixes() {
+			if p.Contains(addr) && p.Bits() >= bits {
+				bits, match = p.Bits(), !entries[i].NoMatch
+			}
+		}
+	}
+	return match
+}
+
+func TestAggregate(t *testing.T) {
+	for _, tc := range []struct {
+		elems    []string
+		expected []string
+	}{
+		{[]string{"10.0.0.0/24", "10.0.1.0/24", "10.0.0.128/25"}, []string{"10.0.0.0/23"}},
+		{[]string{"10.0.0.0/8", "!10.1.0.0/16", "10.1.2.0/24"}, []string{"10.0.0.0/8", "10.1.0.0/16 nomatch", "10.1.2.0/24"}},
+		{[]string{"10.0.0.0/8", "!10.1.0.0/16", "10.1.0.0/17", "10.1.128.0/17"}, []string{"10.0.0.0/8"}},
+		{[]string{"!10.0.0.0/8", "192.168.0.0/24"}, []string{"192.168.0.0/24"}},
+		{[]string{"10.0.0.0/25", "10.0.0.128/26", "10.0.0.192/27", "10.0.0.224/28", "10.0.0.240/29", "10.0.0.248/30", "10.0.0.252/31", "10.0.0.254"},
+			[]string{"10.0.0.0/24", "10.0.0.255 nomatch"}},
+		{[]string{"0.0.0.0/1", "128.0.0.0/1"}, []string{"0.0.0.0/1", "128.0.0.0/1"}},
+		{[]string{"0.0.0.0/2", "64.0.0.0/2", "128.0.0.0/1", "!10.0.0.0/8"}, []string{"0.0.0.0/1", "128.0.0.0/1", "10.0.0.0/8 nomatch"}},
+		{[]string{"::/1", "8000::/1"}, []string{"::/1", "8000::/1"}},
+		{[]string{"10.0.0.1-10.0.0.6", "2001:db8::/33", "2001:db8:8000::/33"}, []string{"10.0.0.0/29", "10.0.0.0 nomatch", "10.0.0.7 nomatch", "2001:db8::/32"}},
+	} {
+		var entries []Entry
+		for _, elem := range tc.elems {
+			args := []string{elem}
+			if elem[0] == '!' {
+				args = []string{elem[1:], "nomatch"}
+			}
+			e, err := ParseEntry(TypeHashNet, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries = append(entries, *e)
+		}
+
+		result, err := Aggregate(entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := formatEntries(&Sets{TypeName: TypeHashNet, Entries: result})
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: expected %q, got %q", tc.elems, tc.expected, got)
+		}
+	}
+}
+
+func TestAggregateKeepsOptions(t *testing.T) {
+	entries := []Entry{
+		{IP: net.ParseIP("10.0.0.0").To4(), CIDR: 8, Comment: "kept"},
+		{IP: net.ParseIP("10.1.0.0").To4(), CIDR: 16, Comment: "merged"},
+	}
+	result, err := Aggregate(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].Comment != "kept" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+// TestAggregateMembership checks on random entries that the aggregated
+// entries match the same addresses and are no more than the original ones.
+func TestAggregateMembership(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	base := netip.MustParseAddr("10.0.0.0").As4()
+
+	for round := 0; round < 300; round++ {
+		entries := make([]Entry, 1+rnd.Intn(12))
+		for i := range entries {
+			bits := 24 + rnd.Intn(9)
+			ip := base
+			ip[3] = byte(rnd.Intn(256))
+			p := netip.PrefixFrom(netip.AddrFrom4(ip), bits).Masked()
+			entries[i] = prefixEntry(p)
+			entries[i].NoMatch = rnd.Intn(3) == 0
+		}
+
+		result, err := Aggregate(entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		distinct := map[string]bool{}
+		for i := range entries {
+			distinct[entries[i].Elem(TypeHashNet)] = true
+		}
+		if len(result) > len(distinct) {
+			t.Errorf("round %d: %d entries aggregated into %d", round, len(distinct), len(result))
+		}
+		for i := 0; i < 256; i++ {
+			ip := base
+			ip[3] = byte(i)
+			addr := netip.AddrFrom4(ip)
+			if matches(entries, addr) != matches(result, addr) {
+				t.Fatalf("round %d: membership of %s differs:\n%q\n%q", round, addr,
+					formatEntries(&Sets{TypeName: TypeHashNet, Entries: entries}),
+					formatEntries(&Sets{TypeName: TypeHashNet, Entries: result}))
+			}
+		}
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	entries := []Entry{
+		{IP: net.ParseIP("10.1.0.0").To4(), CIDR: 16},
+		{IP: net.ParseIP("10.0.0.0").To4(), CIDR: 8},
+		{IP: net.ParseIP("192.168.0.0").To4(), CIDR: 24},
+		{IP: net.ParseIP("10.2.3.4").To4(), CIDR: 32},
+	}
+	overlaps, err := Overlaps(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range overlaps {
+		got = append(got, o.Entry.Elem(TypeHashNet)+" in "+o.By.Elem(TypeHashNet))
+	}
+	if expected := []string{"10.1.0.0/16 in 10.0.0.0/8", "10.2.3.4 in 10.0.0.0/8"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,128 @@
+package ipset
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// Union returns a set of the entries of a or b. The entries of a win over
+// those of b with the same element. Like the results of Intersection and
+// Difference, it has the header of a but no name: see WriteSet.
+func Union(a, b *Sets) (*Sets, error) {
+	return combine(a, b, ranges.union, func(inA, inB bool) bool { return inA || inB })
+}
+
+// Intersection returns a set of the entries of a also in b.
+func Intersection(a, b *Sets) (*Sets, error) {
+	return combine(a, b, ranges.intersect, func(inA, inB bool) bool { return inA && inB })
+}
+
+// Difference returns a set of the entries of a not in b.
+func Difference(a, b *Sets) (*Sets, error) {
+	return combine(a, b, ranges.subtract, func(inA, inB bool) bool { return inA && !inB })
+}
+
+// combine applies a set operation to a and b. hash:net sets are combined by
+// address, with nomatch entries carved out of their networks, so that 10.0.0.0/8
+// minus 10.1.0.0/16 yields the networks covering the remaining addresses.
+// Other sets are combined by element.
+func combine(a, b *Sets, op func(ranges, ranges) ranges, keep func(inA, inB bool) bool) (*Sets, error) {
+	if a.TypeName != b.TypeName {
+		return nil, fmt.Errorf("sets %s and %s are of different types %s and %s", a.SetName, b.SetName, a.TypeName, b.TypeName)
+	}
+	if a.Family != b.Family {
+		return nil, fmt.Errorf("sets %s and %s are of different families %s and %s", a.SetName, b.SetName, FamilyName(a.Family), FamilyName(b.Family))
+	}
+
+	// the result is no set of the kernel yet, it has the header of a only
+	result := *a
+	result.SetName, result.Index = "", 0
+	result.Entries, result.NumEntries, result.SizeInMemory, result.References = nil, 0, 0, 0
+
+	if a.TypeName == TypeHashNet {
+		ra, err := memberRanges(a)
+		if err != nil {
+			return nil, err
+		}
+		rb, err := memberRanges(b)
+		if err != nil {
+			return nil, err
+		}
+		result.Entries = prefixEntries(op(ra, rb).prefixes(), a, b)
+	} else {
+		inA, inB := elements(a), elements(b)
+		for _, s := range []*Sets{a, b} {
+			for i := range s.Entries {
+				elem := s.Entries[i].Elem(s.TypeName)
+				_, ina := inA[elem]
+				_, inb := inB[elem]
+				if keep(ina, inb) {
+					result.Entries = append(result.Entries, s.Entries[i])
+					// add each element once
+					delete(inA, elem)
+					delete(inB, elem)
+				}
+			}
+		}
+	}
+
+	result.NumEntries = uint32(len(result.Entries))
+	return &result, nil
+}
+
+// memberRanges returns the addresses matching a hash:net set: the more
+// specific a network, the higher its precedence, so a nomatch network
+// excludes its addresses from the enclosing ones.
+func memberRanges(s *Sets) (ranges, error) {
+	type layer struct {
+		r       addrRange
+		bits    int
+		nomatch bool
+	}
+	var layers []layer
+	for i := range s.Entries {
+		e := &s.Entries[i]
+		r, ok := entryRange(e)
+		if !ok {
+			return nil, fmt.Errorf("set %s: invalid entry %s", s.SetName, e.Elem(s.TypeName))
+		}
+		for _, p := range r.prefixes() {
+			layers = append(layers, layer{prefixRange(p), p.Bits(), e.NoMatch})
+		}
+	}
+	sort.SliceStable(layers, func(i, j int) bool { return layers[i].bits < layers[j].bits })
+
+	var result ranges
+	for _, l := range layers {
+		if l.nomatch {
+			result = result.subtract(ranges{l.r})
+		} else {
+			result = result.union(ranges{l.r})
+		}
+	}
+	return result, nil
+}
+
+// prefixEntries returns entries of the networks, with the options of the
+// entry of the first of sets holding the same network.
+func prefixEntries(prefixes []netip.Prefix, sets ...*Sets) []Entry {
+	known := make(map[string]*Entry)
+	for i := len(sets) - 1; i >= 0; i-- {
+		s := sets[i]
+		for j := range s.Entries {
+			if e := &s.Entries[j]; !e.NoMatch {
+				known[e.Elem(s.TypeName)] = e
+			}
+		}
+	}
+
+	entries := make([]Entry, len(prefixes))
+	for i, p := range prefixes {
+		entries[i] = prefixEntry(p)
+		if e, ok := known[entries[i].Elem(TypeHashNet)]; ok {
+			entries[i] = *e
+		}
+	}
+	return entries
+}
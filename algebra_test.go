@@ -0,0 +1,114 @@
+package ipset
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testSet(t *testing.T, name, typename string, elems ...string) *Sets {
+	t.Helper()
+	s := &Sets{SetName: name, TypeName: typename, Family: FamilyIPV4}
+	for _, elem := range elems {
+		args := []string{elem}
+		if len(elem) > 0 && elem[0] == '!' {
+			args = []string{elem[1:], "nomatch"}
+		}
+		e, err := ParseEntry(typename, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Entries = append(s.Entries, *e)
+	}
+	return s
+}
+
+func formatEntries(s *Sets) []string {
+	var elems []string
+	for i := range s.Entries {
+		elems = append(elems, s.Entries[i].Format(s.TypeName))
+	}
+	return elems
+}
+
+func TestSetAlgebraNet(t *testing.T) {
+	blocklist := testSet(t, "blocklist", TypeHashNet, "10.0.0.0/8", "192.168.0.0/24", "192.168.1.0/24")
+	allowlist := testSet(t, "allowlist", TypeHashNet, "10.1.0.0/16", "172.16.0.0/12")
+	blocklist.Entries[0].Comment = "feed"
+
+	for _, tc := range []struct {
+		name     string
+		op       func(a, b *Sets) (*Sets, error)
+		expected []string
+	}{
+		{"union", Union, []string{`10.0.0.0/8 comment "feed"`, "172.16.0.0/12", "192.168.0.0/23"}},
+		{"intersection", Intersection, []string{"10.1.0.0/16"}},
+		{"difference", Difference, []string{
+			"10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13",
+			"10.16.0.0/12", "10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9",
+			"192.168.0.0/23",
+		}},
+	} {
+		result, err := tc.op(blocklist, allowlist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatEntries(result); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, got)
+		}
+		if result.SetName != "" || result.HashSize != blocklist.HashSize || int(result.NumEntries) != len(result.Entries) {
+			t.Errorf("%s: unexpected header %+v", tc.name, result)
+		}
+	}
+}
+
+func TestSetAlgebraFullSpace(t *testing.T) {
+	low := testSet(t, "low", TypeHashNet, "0.0.0.0/1")
+	high := testSet(t, "high", TypeHashNet, "128.0.0.0/1", "10.0.0.0/8")
+	result, err := Union(low, high)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a /0 would be read as the host 0.0.0.0
+	if got, expected := formatEntries(result), []string{"0.0.0.0/1", "128.0.0.0/1"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestSetAlgebraNoMatch(t *testing.T) {
+	a := testSet(t, "a", TypeHashNet, "10.0.0.0/8", "!10.1.0.0/16", "10.1.2.0/24")
+	b := testSet(t, "b", TypeHashNet, "10.1.0.0/16")
+
+	result, err := Intersection(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := formatEntries(result), []string{"10.1.2.0/24"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestSetAlgebraElements(t *testing.T) {
+	a := testSet(t, "a", TypeHashIPPort, "10.0.0.1,tcp:80", "10.0.0.2,tcp:80")
+	b := testSet(t, "b", TypeHashIPPort, "10.0.0.2,tcp:80", "10.0.0.3,udp:53")
+
+	for _, tc := range []struct {
+		op       func(a, b *Sets) (*Sets, error)
+		expected []string
+	}{
+		{Union, []string{"10.0.0.1,tcp:80", "10.0.0.2,tcp:80", "10.0.0.3,udp:53"}},
+		{Intersection, []string{"10.0.0.2,tcp:80"}},
+		{Difference, []string{"10.0.0.1,tcp:80"}},
+	} {
+		result, err := tc.op(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatEntries(result); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("expected %q, got %q", tc.expected, got)
+		}
+	}
+
+	if _, err := Union(a, testSet(t, "c", TypeHashIP)); err == nil {
+		t.Error("expected sets of different types to be refused")
+	}
+}
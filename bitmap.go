@@ -0,0 +1,126 @@
+package ipset
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// BitmapMaxElements is the most elements a bitmap set holds.
+const BitmapMaxElements = 65536
+
+// BitmapIPOptions returns the options of a bitmap:ip or bitmap:ip,mac set
+// covering prefix. A non-zero netmask makes a bitmap:ip set store the
+// networks of that size instead of addresses.
+func BitmapIPOptions(prefix netip.Prefix, netmask uint8) (CreateOptions, error) {
+	if !prefix.IsValid() || !prefix.Addr().Is4() {
+		return CreateOptions{}, fmt.Errorf("bitmap range %s is not an IPv4 prefix", prefix)
+	}
+	prefix = prefix.Masked()
+
+	from := prefix.Addr().As4()
+	to := binary.BigEndian.Uint32(from[:]) | uint32(0xffffffff)>>prefix.Bits()
+	opts := CreateOptions{
+		Family:  FamilyIPV4,
+		IPFrom:  net.IP(from[:]),
+		IPTo:    make(net.IP, net.IPv4len),
+		NetMask: uint32(netmask),
+	}
+	binary.BigEndian.PutUint32(opts.IPTo, to)
+	return opts, opts.validateBitmap(TypeBitmapIP)
+}
+
+// BitmapPortOptions returns the options of a bitmap:port set of the ports
+// from through to.
+func BitmapPortOptions(from, to uint16) (CreateOptions, error) {
+	opts := CreateOptions{PortFrom: from, PortTo: to}
+	return opts, opts.validateBitmap(TypeBitmapPort)
+}
+
+// validateBitmap checks the range and netmask of a bitmap set as the kernel
+// does, so that an invalid range is reported with the offending values.
+func (opt *CreateOptions) validateBitmap(typename string) error {
+	if typename == TypeBitmapPort {
+		if opt.PortFrom > opt.PortTo {
+			return fmt.Errorf("bitmap port range %d-%d is reversed", opt.PortFrom, opt.PortTo)
+		}
+		// a port range cannot exceed BitmapMaxElements
+		return nil
+	}
+
+	from, to := opt.IPFrom.To4(), opt.IPTo.To4()
+	if from == nil || to == nil {
+		return fmt.Errorf("bitmap range %s-%s is not an IPv4 range", opt.IPFrom, opt.IPTo)
+	}
+	first, last := binary.BigEndian.Uint32(from), binary.BigEndian.Uint32(to)
+	if first > last {
+		return fmt.Errorf("bitmap range %s-%s is reversed", from, to)
+	}
+
+	elements := uint64(last) - uint64(first) + 1
+	if netmask := opt.NetMask; netmask != 0 && netmask != 32 {
+		if typename != TypeBitmapIP {
+			return fmt.Errorf("netmask cannot be used with type %s", typename)
+		}
+		if netmask > 32 {
+			return fmt.Errorf("netmask %d is invalid for family inet", netmask)
+		}
+		bits, ok := rangeBits(first, last)
+		if !ok {
+			return fmt.Errorf("bitmap range %s-%s must be a network to use netmask %d", from, to, netmask)
+		}
+		if netmask <= bits {
+			return fmt.Errorf("netmask %d must be longer than the prefix of bitmap range %s/%d", netmask, from, bits)
+		}
+		elements = 1 << (netmask - bits)
+	}
+
+	if elements > BitmapMaxElements {
+		return fmt.Errorf("bitmap range %s-%s holds %d elements, at most %d allowed", from, to, elements, BitmapMaxElements)
+	}
+	return nil
+}
+
+// rangeBits returns the prefix length of the network first-last, if it is
+// one.
+func rangeBits(first, last uint32) (uint32, bool) {
+	for bits := uint32(0); bits <= 32; bits++ {
+		mask := ^(uint32(0xffffffff) >> bits)
+		if first&mask == first && first|^mask == last {
+			return bits, true
+		}
+	}
+	return 0, false
+}
+
+// BitmapRangeError is returned when adding an element outside of the range
+// of a bitmap set.
+type BitmapRangeError struct {
+	SetName string
+	Elem    string
+	Range   string
+}
+
+func (e *BitmapRangeError) Error() string {
+	return fmt.Sprintf("element %s is out of the range %s of set %s", e.Elem, e.Range, e.SetName)
+}
+
+// Unwrap returns the kernel error.
+func (e *BitmapRangeError) Unwrap() error {
+	return IPSetError(IPSET_ERR_BITMAP_RANGE)
+}
+
+// bitmapRangeError describes err, returned when adding entry to set, if it
+// is a range error.
+func bitmapRangeError(set *Sets, entry *Entry, err error) error {
+	if TypeName(set.TypeName).Method() != "bitmap" || err != IPSetError(IPSET_ERR_BITMAP_RANGE) {
+		return err
+	}
+	header := set.HeaderOptions()
+	r := ""
+	if len(header) >= 2 && header[0] == "range" {
+		r = header[1]
+	}
+	return &BitmapRangeError{SetName: set.SetName, Elem: entry.Elem(set.TypeName), Range: r}
+}
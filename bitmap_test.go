@@ -0,0 +1,70 @@
+package ipset
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestBitmapIPOptions(t *testing.T) {
+	for _, tc := range []struct {
+		prefix  string
+		netmask uint8
+		from    string
+		to      string
+		valid   bool
+	}{
+		{"10.0.0.0/16", 0, "10.0.0.0", "10.0.255.255", true},
+		{"10.0.3.4/24", 0, "10.0.3.0", "10.0.3.255", true},
+		{"10.0.0.1/32", 0, "10.0.0.1", "10.0.0.1", true},
+		{"10.0.0.0/15", 0, "", "", false},
+		{"10.0.0.0/8", 24, "10.0.0.0", "10.255.255.255", true},
+		{"10.0.0.0/8", 25, "", "", false},
+		{"10.0.0.0/8", 8, "", "", false},
+		{"0.0.0.0/0", 16, "0.0.0.0", "255.255.255.255", true},
+		{"2001:db8::/120", 0, "", "", false},
+	} {
+		opts, err := BitmapIPOptions(netip.MustParsePrefix(tc.prefix), tc.netmask)
+		if (err == nil) != tc.valid {
+			t.Errorf("%s netmask %d: unexpected error %v", tc.prefix, tc.netmask, err)
+			continue
+		}
+		if tc.valid && (opts.IPFrom.String() != tc.from || opts.IPTo.String() != tc.to) {
+			t.Errorf("%s: expected %s-%s, got %s-%s", tc.prefix, tc.from, tc.to, opts.IPFrom, opts.IPTo)
+		}
+	}
+}
+
+func TestValidateBitmap(t *testing.T) {
+	if _, err := BitmapPortOptions(1024, 1023); err == nil {
+		t.Error("expected a reversed port range to be invalid")
+	}
+	if _, err := BitmapPortOptions(0, 65535); err != nil {
+		t.Error(err)
+	}
+
+	opts := CreateOptions{IPFrom: parseIP("10.0.0.1"), IPTo: parseIP("10.0.0.200"), NetMask: 30}
+	if err := opts.validateBitmap(TypeBitmapIP); err == nil {
+		t.Error("expected netmask with a range not a network to be invalid")
+	}
+	opts.NetMask = 0
+	if err := opts.validateBitmap(TypeBitmapIP); err != nil {
+		t.Error(err)
+	}
+	opts.NetMask = 30
+	if err := opts.validateBitmap(TypeBitmapIPMac); err == nil {
+		t.Error("expected netmask with bitmap:ip,mac to be invalid")
+	}
+}
+
+func TestBitmapRangeError(t *testing.T) {
+	set := &Sets{SetName: "hosts", TypeName: TypeBitmapIP, IPFrom: parseIP("10.0.0.0"), IPTo: parseIP("10.0.0.255")}
+	err := bitmapRangeError(set, &Entry{IP: parseIP("10.0.1.1")}, IPSetError(IPSET_ERR_BITMAP_RANGE))
+	if expected := "element 10.0.1.1 is out of the range 10.0.0.0-10.0.0.255 of set hosts"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err)
+	}
+
+	set.TypeName = TypeHashIP
+	if err := bitmapRangeError(set, &Entry{}, IPSetError(IPSET_ERR_HASH_FULL)); err != IPSetError(IPSET_ERR_HASH_FULL) {
+		t.Errorf("expected the error of a hash set to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package ipset
+
+import (
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+// MaxSetsParameter holds the max_sets parameter of the ip_set module.
+var MaxSetsParameter = "/sys/module/ip_set/parameters/max_sets"
+
+// Capabilities describes what the running kernel supports.
+type Capabilities struct {
+	Protocol    uint8 // protocol version of the kernel
+	ProtocolMin uint8 // oldest protocol version the kernel accepts
+	// MaxSets is the max_sets parameter of the ip_set module. Zero means the
+	// kernel default (CONFIG_IP_SET_MAX) is in effect or it is unknown.
+	MaxSets int
+	Types   []TypeCapability
+}
+
+// TypeCapability describes the support of a set type.
+type TypeCapability struct {
+	TypeName    string
+	Available   bool
+	MinRevision uint8
+	MaxRevision uint8
+	Err         error // why the type is not available
+}
+
+// Supports reports whether the kernel supports typename at revision.
+func (c *Capabilities) Supports(typename string, revision uint8) bool {
+	for _, t := range c.Types {
+		if t.TypeName == typename {
+			return t.Available && revision >= t.MinRevision && revision <= t.MaxRevision
+		}
+	}
+	return false
+}
+
+// TypeRevisions returns the revisions of a set type the kernel supports.
+// It fails with ErrInvalidType if the module of the type is not loaded.
+func (h *Handle) TypeRevisions(typename string) (min, max uint8, err error) {
+	req := h.newRequestFamily(IPSET_CMD_TYPE, FamilyIPV4)
+	req.AddData(nl.NewRtAttr(IPSET_ATTR_TYPENAME, nl.ZeroTerminated(typename)))
+	req.AddData(nl.NewRtAttr(IPSET_ATTR_FAMILY, nl.Uint8Attr(FamilyIPV4)))
+
+	msgs, err := h.execute(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	result := ipsetUnserialize(msgs)
+	// IPSET_ATTR_REVISION_MIN shares its number with IPSET_ATTR_PROTOCOL_MIN
+	return result.ProtocolMinVersion, result.Revision, nil
+}
+
+// Capabilities probes the protocol version, the available set types and
+// their revisions, and the maximal number of sets.
+func (h *Handle) Capabilities() (*Capabilities, error) {
+	protocol, protocolMin, err := h.Protocol()
+	if err != nil {
+		return nil, err
+	}
+	c := &Capabilities{Protocol: protocol, ProtocolMin: protocolMin}
+
+	if data, err := ioutil.ReadFile(MaxSetsParameter); err == nil {
+		c.MaxSets, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+
+	typenames := make([]string, 0, len(typeRevisionsMap))
+	for typename := range typeRevisionsMap {
+		typenames = append(typenames, typename)
+	}
+	sort.Strings(typenames)
+
+	for _, typename := range typenames {
+		t := TypeCapability{TypeName: typename}
+		t.MinRevision, t.MaxRevision, t.Err = h.TypeRevisions(typename)
+		t.Available = t.Err == nil
+		c.Types = append(c.Types, t)
+	}
+	return c, nil
+}
@@ -0,0 +1,64 @@
+package ipset
+
+import "fmt"
+
+// Clone creates the set dst with the header of src and, if withEntries,
+// its entries, so that changes can be staged on dst before swapping it
+// with src.
+func (h *Handle) Clone(src, dst string, withEntries bool) error {
+	set, err := h.List(src)
+	if err != nil {
+		return err
+	}
+
+	opts := set.CreateOptions()
+	if err := h.Create(dst, set.TypeName, opts); err != nil {
+		return err
+	}
+	if !withEntries {
+		return nil
+	}
+	if _, err := h.copyEntries(dst, set.Entries); err != nil {
+		h.Destroy(dst)
+		return err
+	}
+	return nil
+}
+
+// copyEntries adds entries to setname in batches fitting a netlink message
+// each and returns the number of entries added.
+func (h *Handle) copyEntries(setname string, entries []Entry) (copied int, err error) {
+	ptrs := make([]*Entry, len(entries))
+	for i := range entries {
+		ptrs[i] = &entries[i]
+	}
+	batches, err := splitBatch(ptrs)
+	if err != nil {
+		return 0, err
+	}
+	for _, batch := range batches {
+		if err := h.AddBatch(setname, batch); err != nil {
+			return copied, err
+		}
+		copied += len(batch)
+	}
+	return copied, nil
+}
+
+// WriteSet adds the entries of set, such as the result of Union, to the set
+// setname, creating it with the header of set if it does not exist. Entries
+// already in the set are updated.
+func (h *Handle) WriteSet(setname string, set *Sets) error {
+	if setname == "" {
+		return fmt.Errorf("ipset: no set name to write to")
+	}
+	if _, err := h.Header(setname); isNotExist(err) {
+		if err := h.Create(setname, set.TypeName, set.CreateOptions()); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	_, err := h.copyEntries(setname, set.Entries)
+	return err
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lrh3321/ipset-go"
+)
+
+func runList(opts *options, args []string, out io.Writer) error {
+	if len(args) > 1 {
+		return usagef("list accepts at most one set name")
+	}
+
+	sets, err := listSets(args)
+	if err != nil {
+		return err
+	}
+
+	if opts.name {
+		for _, s := range sets {
+			fmt.Fprintln(out, s.SetName)
+		}
+		return nil
+	}
+
+	switch opts.output {
+	case "save":
+		return writeSave(out, sets, opts)
+	case "xml":
+		return writeXML(out, sets, opts)
+	}
+	return writePlain(out, sets, opts)
+}
+
+func runSave(opts *options, args []string, out io.Writer) error {
+	if len(args) > 1 {
+		return usagef("save accepts at most one set name")
+	}
+
+	sets, err := listSets(args)
+	if err != nil {
+		return err
+	}
+
+	if opts.output == "xml" {
+		return writeXML(out, sets, opts)
+	}
+	return writeSave(out, sets, opts)
+}
+
+// listSets dumps the named set, or all sets if no name is given.
+func listSets(args []string) ([]ipset.Sets, error) {
+	if len(args) == 0 {
+		return ipset.ListAll()
+	}
+
+	set, err := ipset.List(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return []ipset.Sets{*set}, nil
+}
+
+func writePlain(out io.Writer, sets []ipset.Sets, opts *options) error {
+	for i := range sets {
+		s := &sets[i]
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "Name: %s\n", s.SetName)
+		fmt.Fprintf(out, "Type: %s\n", s.TypeName)
+		fmt.Fprintf(out, "Revision: %d\n", s.Revision)
+		fmt.Fprintf(out, "Header: %s\n", strings.Join(s.HeaderOptions(), " "))
+		fmt.Fprintf(out, "Size in memory: %d\n", s.SizeInMemory)
+		fmt.Fprintf(out, "References: %d\n", s.References)
+		fmt.Fprintf(out, "Number of entries: %d\n", s.NumEntries)
+		if opts.terse {
+			continue
+		}
+
+		fmt.Fprintln(out, "Members:")
+		for _, line := range members(s, opts) {
+			fmt.Fprintln(out, line)
+		}
+	}
+	return nil
+}
+
+func writeSave(out io.Writer, sets []ipset.Sets, opts *options) error {
+	for i := range sets {
+		s := &sets[i]
+		create := append([]string{"create", s.SetName, s.TypeName}, s.HeaderOptions()...)
+		fmt.Fprintln(out, strings.Join(create, " "))
+		if opts.terse {
+			continue
+		}
+		for _, line := range members(s, opts) {
+			fmt.Fprintf(out, "add %s %s\n", s.SetName, line)
+		}
+	}
+	return nil
+}
+
+// members formats the entries of a set, one per line.
+func members(s *ipset.Sets, opts *options) []string {
+	lines := make([]string, len(s.Entries))
+	for i := range s.Entries {
+		e := &s.Entries[i]
+		if opts.resolve {
+			lines[i] = strings.Join(append([]string{resolveElem(s.TypeName, e)}, e.Options()...), " ")
+		} else {
+			lines[i] = e.Format(s.TypeName)
+		}
+	}
+	if opts.sorted {
+		sort.Strings(lines)
+	}
+	return lines
+}
+
+// resolveElem formats the element of an entry with its addresses replaced by
+// host names where a reverse lookup succeeds.
+func resolveElem(typename string, e *ipset.Entry) string {
+	elem := e.Elem(typename)
+	for _, ip := range []net.IP{e.IP, e.IP2} {
+		if ip == nil {
+			continue
+		}
+		if names, err := net.LookupAddr(ip.String()); err == nil && len(names) > 0 {
+			elem = strings.Replace(elem, ip.String(), strings.TrimSuffix(names[0], "."), 1)
+		}
+	}
+	return elem
+}
+
+// parseCreateOptions parses the type specific options of the create command.
+func parseCreateOptions(typename string, args []string) (ipset.CreateOptions, error) {
+	var opts ipset.CreateOptions
+
+	uintArg := func(i int, bits int) (uint64, error) {
+		if i+1 >= len(args) {
+			return 0, usagef("missing value for option %q", args[i])
+		}
+		v, err := strconv.ParseUint(args[i+1], 0, bits)
+		if err != nil {
+			return 0, usagef("invalid value for option %q: %q", args[i], args[i+1])
+		}
+		return v, nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		var (
+			v   uint64
+			err error
+		)
+		switch args[i] {
+		case "counters":
+			opts.Counters = true
+		case "comment":
+			opts.Comments = true
+		case "skbinfo":
+			opts.Skbinfo = true
+		case "forceadd":
+			opts.ForceAdd = true
+		case "-4", "-6":
+			opts.Family, _ = ipset.ParseFamily(args[i])
+		case "family":
+			if i+1 >= len(args) {
+				return opts, usagef("missing value for option %q", args[i])
+			}
+			i++
+			opts.Family, err = ipset.ParseFamily(args[i])
+			if err != nil {
+				return opts, usagef("%v", err)
+			}
+		case "hashsize", "size":
+			v, err = uintArg(i, 32)
+			opts.Size = uint32(v)
+			i++
+		case "maxelem":
+			v, err = uintArg(i, 32)
+			opts.MaxElements = uint32(v)
+			i++
+		case "timeout":
+			v, err = uintArg(i, 32)
+			opts.Timeout = uint32(v)
+			i++
+		case "netmask":
+			v, err = uintArg(i, 8)
+			opts.NetMask = uint32(v)
+			i++
+		case "bitmask":
+			if i+1 >= len(args) {
+				return opts, usagef("missing value for option %q", args[i])
+			}
+			i++
+			if opts.BitMask = net.ParseIP(args[i]); opts.BitMask == nil {
+				return opts, usagef("invalid value for option %q: %q", "bitmask", args[i])
+			}
+		case "markmask":
+			v, err = uintArg(i, 32)
+			opts.MarkMask = uint32(v)
+			i++
+		case "range":
+			if ipset.TypeName(typename).Method() != "bitmap" {
+				return opts, usagef("unknown argument: %q", args[i])
+			}
+			if i+1 >= len(args) {
+				return opts, usagef("missing value for option %q", args[i])
+			}
+			i++
+			err = parseRange(typename, args[i], &opts)
+		default:
+			return opts, usagef("unknown argument: %q", args[i])
+		}
+		if err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+func parseRange(typename, value string, opts *ipset.CreateOptions) error {
+	if typename == ipset.TypeBitmapPort {
+		if idx := strings.IndexByte(value, ':'); idx >= 0 {
+			value = value[idx+1:]
+		}
+		idx := strings.IndexByte(value, '-')
+		if idx < 0 {
+			return usagef("invalid port range: %q", value)
+		}
+		from, err := strconv.ParseUint(value[:idx], 10, 16)
+		if err != nil {
+			return usagef("invalid port range: %q", value)
+		}
+		to, err := strconv.ParseUint(value[idx+1:], 10, 16)
+		if err != nil {
+			return usagef("invalid port range: %q", value)
+		}
+		opts.PortFrom, opts.PortTo = uint16(from), uint16(to)
+		return nil
+	}
+
+	if _, ipnet, err := net.ParseCIDR(value); err == nil {
+		from := ipnet.IP.To4()
+		if from == nil {
+			return usagef("invalid ip range: %q", value)
+		}
+		to := make(net.IP, len(from))
+		for i := range from {
+			to[i] = from[i] | ^ipnet.Mask[i]
+		}
+		opts.IPFrom, opts.IPTo = from, to
+		return nil
+	}
+
+	idx := strings.IndexByte(value, '-')
+	if idx < 0 {
+		return usagef("invalid ip range: %q", value)
+	}
+	opts.IPFrom, opts.IPTo = net.ParseIP(value[:idx]).To4(), net.ParseIP(value[idx+1:]).To4()
+	if opts.IPFrom == nil || opts.IPTo == nil {
+		return usagef("invalid ip range: %q", value)
+	}
+	return nil
+}
+
+func writeXML(out io.Writer, sets []ipset.Sets, opts *options) error {
+	if opts.terse {
+		headers := make([]ipset.Sets, len(sets))
+		for i := range sets {
+			headers[i] = sets[i]
+			headers[i].Entries = nil
+		}
+		sets = headers
+	}
+	return ipset.EncodeXML(out, sets)
+}
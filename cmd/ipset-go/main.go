@@ -0,0 +1,467 @@
+// Command ipset-go is a static replacement for the ipset utility built on
+// github.com/lrh3321/ipset-go. It accepts the command and option syntax of
+// ipset(8), so it can be used where the C tool is not available.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/lrh3321/ipset-go"
+)
+
+// version is the version of the tool, set at build time with
+// -ldflags "-X main.version=...".
+var version = "dev"
+
+const (
+	exitOK = iota
+	exitError
+	exitParameterProblem
+)
+
+// usageError is an error in the command line rather than in the kernel.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// options are the general options of the ipset utility.
+type options struct {
+	exist   bool
+	output  string
+	quiet   bool
+	resolve bool
+	sorted  bool
+	name    bool
+	terse   bool
+	file    string
+	debug   bool
+}
+
+type command struct {
+	name    string
+	aliases []string
+	args    string
+	help    string
+	run     func(opts *options, args []string, out io.Writer) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"create", []string{"n", "-N"}, "SETNAME TYPENAME [type-specific-options]", "Create a new set", runCreate},
+		{"add", []string{"a", "-A"}, "SETNAME ENTRY", "Add entry to the named set", runAdd},
+		{"del", []string{"d", "-D"}, "SETNAME ENTRY", "Delete entry from the named set", runDel},
+		{"test", []string{"t", "-T"}, "SETNAME ENTRY", "Test entry in the named set", runTest},
+		{"destroy", []string{"x", "-X"}, "[SETNAME]", "Destroy a named set or all sets", runDestroy},
+		{"list", []string{"l", "-L"}, "[SETNAME]", "List the entries of a named set or all sets", runList},
+		{"save", []string{"s", "-S"}, "[SETNAME]", "Save the named set or all sets to stdout", runSave},
+		{"restore", []string{"r", "-R"}, "", "Restore a saved state", runRestore},
+		{"flush", []string{"f", "-F"}, "[SETNAME]", "Flush a named set or all sets", runFlush},
+		{"rename", []string{"e", "-E"}, "FROM-SETNAME TO-SETNAME", "Rename two sets", runRename},
+		{"swap", []string{"w", "-W"}, "FROM-SETNAME TO-SETNAME", "Swap the content of two existing sets", runSwap},
+		{"help", []string{"h", "-H", "-h", "--help"}, "[TYPENAME]", "Print help, and settype specific help", runHelp},
+		{"version", []string{"v", "-V", "-v", "--version"}, "", "Print version information", runVersion},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+		for _, alias := range c.aliases {
+			if alias == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	opts, rest, err := parseOptions(args)
+	if err == nil && opts.debug {
+		ipset.SetTrace(func(m ipset.TraceMessage) {
+			fmt.Fprintln(stderr, m)
+		})
+		defer ipset.SetTrace(nil)
+	}
+	if err == nil {
+		err = dispatch(opts, rest, stdout)
+	}
+	if err == nil {
+		return exitOK
+	}
+	if opts != nil && opts.quiet {
+		return exitCode(err)
+	}
+
+	fmt.Fprintf(stderr, "ipset-go %s: %s\n", version, errorMessage(err))
+	if _, ok := err.(*usageError); ok {
+		fmt.Fprintln(stderr, "Try `ipset-go help' for more information.")
+	}
+	return exitCode(err)
+}
+
+func exitCode(err error) int {
+	if _, ok := err.(*usageError); ok {
+		return exitParameterProblem
+	}
+	return exitError
+}
+
+// parseOptions extracts the general options, which may appear anywhere in
+// the command line, and returns the remaining arguments.
+func parseOptions(args []string) (*options, []string, error) {
+	opts := &options{output: "plain"}
+	var rest []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-exist", "-!", "--exist":
+			opts.exist = true
+		case "-quiet", "-q", "--quiet":
+			opts.quiet = true
+		case "-resolve", "-r", "--resolve":
+			opts.resolve = true
+		case "-sorted", "-s", "--sorted":
+			opts.sorted = true
+		case "-name", "-n", "--name":
+			opts.name = true
+		case "-terse", "-t", "--terse":
+			opts.terse = true
+		case "-debug", "-d", "--debug":
+			opts.debug = true
+		case "-output", "-o", "--output":
+			if i+1 >= len(args) {
+				return opts, nil, usagef("option %s requires an argument", arg)
+			}
+			i++
+			switch args[i] {
+			case "plain", "save", "xml":
+				opts.output = args[i]
+			default:
+				return opts, nil, usagef("syntax error: unknown output mode %q", args[i])
+			}
+		case "-file", "-f", "--file":
+			if i+1 >= len(args) {
+				return opts, nil, usagef("option %s requires an argument", arg)
+			}
+			i++
+			opts.file = args[i]
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return opts, rest, nil
+}
+
+func dispatch(opts *options, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return usagef("no command specified")
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		return usagef("unknown command: %q", args[0])
+	}
+
+	if opts.file != "" && out == os.Stdout {
+		switch cmd.name {
+		case "list", "save":
+			f, err := os.Create(opts.file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+	}
+	return cmd.run(opts, args[1:], out)
+}
+
+func runCreate(opts *options, args []string, _ io.Writer) error {
+	if len(args) < 2 {
+		return usagef("create requires a set name and a type name")
+	}
+	if err := checkSetName(args[0]); err != nil {
+		return err
+	}
+
+	typename := args[1]
+	createOpts, err := parseCreateOptions(typename, args[2:])
+	if err != nil {
+		return err
+	}
+	createOpts.Replace = opts.exist
+	if err := ipset.Create(args[0], typename, createOpts); err != nil {
+		// tell which kernel module is missing
+		return (&ipset.ModuleLoader{}).Explain(typename, err)
+	}
+	return nil
+}
+
+func runAdd(opts *options, args []string, _ io.Writer) error {
+	setname, entry, err := parseSetEntry(args)
+	if err != nil {
+		return err
+	}
+	entry.Replace = opts.exist
+	return ipset.Add(setname, entry)
+}
+
+func runDel(opts *options, args []string, _ io.Writer) error {
+	setname, entry, err := parseSetEntry(args)
+	if err != nil {
+		return err
+	}
+	entry.Replace = opts.exist
+	err = ipset.Del(setname, entry)
+	if err == ipset.ErrEntryNotExist {
+		return errors.New("Element cannot be deleted from the set: it's not added")
+	}
+	return err
+}
+
+func runTest(opts *options, args []string, out io.Writer) error {
+	setname, entry, err := parseSetEntry(args)
+	if err != nil {
+		return err
+	}
+	ok, err := ipset.Test(setname, entry)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s is NOT in set %s.", args[1], setname)
+	}
+	if !opts.quiet {
+		fmt.Fprintf(out, "%s is in set %s.\n", args[1], setname)
+	}
+	return nil
+}
+
+// parseSetEntry parses "SETNAME ENTRY [options]", looking up the type of the
+// set from the kernel.
+func parseSetEntry(args []string) (string, *ipset.Entry, error) {
+	if len(args) < 2 {
+		return "", nil, usagef("a set name and an entry are required")
+	}
+	set, err := ipset.Header(args[0])
+	if err != nil {
+		return "", nil, err
+	}
+	entry, err := ipset.ParseEntry(set.TypeName, args[1:]...)
+	if err != nil {
+		return "", nil, usagef("%v", err)
+	}
+	return args[0], entry, nil
+}
+
+func runDestroy(opts *options, args []string, _ io.Writer) error {
+	if len(args) > 1 {
+		return usagef("destroy accepts at most one set name")
+	}
+	if len(args) == 0 {
+		return ipset.Destroy("")
+	}
+	return ipset.Destroy(args[0])
+}
+
+func runFlush(opts *options, args []string, _ io.Writer) error {
+	if len(args) > 1 {
+		return usagef("flush accepts at most one set name")
+	}
+	if len(args) == 0 {
+		return ipset.Flush("")
+	}
+	return ipset.Flush(args[0])
+}
+
+func runRename(opts *options, args []string, _ io.Writer) error {
+	if len(args) != 2 {
+		return usagef("rename requires two set names")
+	}
+	if err := checkSetName(args[1]); err != nil {
+		return err
+	}
+	return ipset.Rename(args[0], args[1])
+}
+
+func runSwap(opts *options, args []string, _ io.Writer) error {
+	if len(args) != 2 {
+		return usagef("swap requires two set names")
+	}
+	return ipset.Swap(args[0], args[1])
+}
+
+func runVersion(opts *options, args []string, out io.Writer) error {
+	protocol, _, err := ipset.Protocol()
+	if err != nil {
+		fmt.Fprintf(out, "ipset-go %s\n", version)
+		return err
+	}
+	fmt.Fprintf(out, "ipset-go %s, protocol version: %d\n", version, protocol)
+	return nil
+}
+
+func runHelp(opts *options, args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return typeHelp(args[0], out)
+	}
+
+	fmt.Fprintf(out, `ipset-go %s
+
+Usage: ipset-go [options] COMMAND
+
+Commands:
+`, version)
+	for _, c := range commands {
+		fmt.Fprintf(out, "%-32s %s\n", strings.TrimSpace(c.name+" "+c.args), c.help)
+	}
+	fmt.Fprint(out, `
+Options:
+-o plain|save|xml
+       Specify output mode for listing sets.
+       Default value for "list" command is mode "plain"
+       and for "save" command is mode "save".
+-s     Print elements sorted (if supported by the set type).
+-q     Suppress any notice or warning message.
+-r     Try to resolve IP addresses in the output (slow!)
+-!     Ignore errors when creating or adding sets or
+       elements that do exist or when deleting elements
+       that don't exist.
+-n     When listing, just list setnames from the kernel.
+-t     When listing, list setnames and set headers
+       from kernel only.
+-f     Read from the given file instead of standard
+       input (restore) or write to given file instead
+       of standard output (list/save).
+-d     Print the netlink messages exchanged with the kernel
+       to standard error.
+
+Supported set types:
+`)
+	for _, t := range supportedTypes {
+		fmt.Fprintf(out, "    %s\n", t)
+	}
+	return nil
+}
+
+func typeHelp(typename string, out io.Writer) error {
+	dims := ipset.TypeName(typename).Dimensions()
+	known := false
+	for _, t := range supportedTypes {
+		if t == typename {
+			known = true
+		}
+	}
+	if !known {
+		return usagef("unknown settype: %q", typename)
+	}
+
+	fmt.Fprintf(out, "%s type specific options:\n\n", typename)
+	fmt.Fprintf(out, "CREATE-OPTIONS := %s\n", createHelp(typename))
+	fmt.Fprintf(out, "ADD-ENTRY := %s\n", strings.ToUpper(strings.Join(dims, ",")))
+	fmt.Fprint(out, "ADD-OPTIONS := [timeout VALUE] [packets VALUE] [bytes VALUE] [comment \"string\"]\n")
+	fmt.Fprint(out, "               [skbmark VALUE] [skbprio VALUE] [skbqueue VALUE] [nomatch]\n")
+	fmt.Fprintf(out, "DEL-ENTRY := %s\n", strings.ToUpper(strings.Join(dims, ",")))
+	fmt.Fprintf(out, "TEST-ENTRY := %s\n", strings.ToUpper(strings.Join(dims, ",")))
+	return nil
+}
+
+func createHelp(typename string) string {
+	switch ipset.TypeName(typename).Method() {
+	case "bitmap":
+		if typename == ipset.TypeBitmapPort {
+			return "range [PROTO:]FROM-TO [timeout VALUE] [counters] [comment] [skbinfo]"
+		}
+		return "range IP/CIDR|FROM-TO [netmask CIDR] [timeout VALUE] [counters] [comment] [skbinfo]"
+	case "list":
+		return "[size VALUE] [timeout VALUE] [counters] [comment] [skbinfo]"
+	}
+	return "[family inet|inet6] [hashsize VALUE] [maxelem VALUE] [timeout VALUE] [counters] [comment] [skbinfo] [forceadd]"
+}
+
+var supportedTypes = []string{
+	ipset.TypeBitmapIP,
+	ipset.TypeBitmapIPMac,
+	ipset.TypeBitmapPort,
+	ipset.TypeHashIP,
+	ipset.TypeHashIPMac,
+	ipset.TypeHashIPMark,
+	ipset.TypeHashIPPort,
+	ipset.TypeHashIPPortIP,
+	ipset.TypeHashIPPortNet,
+	ipset.TypeHashMac,
+	ipset.TypeHashNet,
+	ipset.TypeHashNetIface,
+	ipset.TypeHashNetNet,
+	ipset.TypeHashNetPort,
+	ipset.TypeHashNetPortNet,
+	ipset.TypeListSet,
+}
+
+func checkSetName(name string) error {
+	if name == "" || len(name) >= ipset.IPSET_MAXNAMELEN {
+		return usagef("setname %q is invalid: it must be 1 to %d characters long", name, ipset.IPSET_MAXNAMELEN-1)
+	}
+	return nil
+}
+
+// errorMessage translates kernel errors into the messages of the ipset
+// utility.
+func errorMessage(err error) string {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case syscall.ENOENT:
+			return "The set with the given name does not exist"
+		case syscall.EEXIST:
+			return "Set cannot be created: set with the same name already exists"
+		case syscall.EPERM:
+			return "Kernel error received: Operation not permitted"
+		}
+	}
+
+	switch err {
+	case ipset.ErrEntryExist:
+		return "Element cannot be added to the set: it's already added"
+	case ipset.ErrBusy:
+		return "Set cannot be destroyed: it is in use by a kernel component"
+	case ipset.ErrNewNameAlreadyExist:
+		return "Set cannot be renamed: a set with the new name already exists"
+	case ipset.ErrTypeMismatch:
+		return "The sets cannot be swapped: their type does not match"
+	case ipset.ErrInvalidType:
+		return "Kernel error received: set type not supported"
+	case ipset.ErrTimeout:
+		return "Timeout cannot be used: set was created without timeout support"
+	case ipset.ErrInvalidCounter:
+		return "Packet/byte counters cannot be used: set was created without counter support"
+	case ipset.ErrInvalidComment:
+		return "Comment cannot be used: set was created without comment support"
+	case ipset.ErrSkbInfo:
+		return "Skbinfo mapping cannot be used: set was created without skbinfo support"
+	}
+	return err.Error()
+}
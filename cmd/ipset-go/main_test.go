@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/lrh3321/ipset-go"
+)
+
+func TestParseOptions(t *testing.T) {
+	opts, rest, err := parseOptions([]string{"-exist", "add", "-q", "-d", "foo", "10.0.0.1", "-o", "xml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.exist || !opts.quiet || !opts.debug || opts.output != "xml" {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+	if !reflect.DeepEqual(rest, []string{"add", "foo", "10.0.0.1"}) {
+		t.Errorf("unexpected arguments: %v", rest)
+	}
+
+	if _, _, err := parseOptions([]string{"list", "-o", "json"}); err == nil {
+		t.Error("expected unknown output mode to be rejected")
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	args, err := splitLine(`add foo 10.0.0.1 timeout 3 comment "hello \"world\""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"add", "foo", "10.0.0.1", "timeout", "3", "comment", `hello "world"`}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %q, got %q", expected, args)
+	}
+
+	if _, err := splitLine(`add foo 10.0.0.1 comment "oops`); err == nil {
+		t.Error("expected unterminated quote to be rejected")
+	}
+}
+
+func TestParseCreateOptions(t *testing.T) {
+	opts, err := parseCreateOptions(ipset.TypeHashIP, []string{"family", "inet6", "hashsize", "2048", "maxelem", "100", "timeout", "30", "counters", "comment"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ipset.CreateOptions{Family: ipset.FamilyIPV6, Size: 2048, MaxElements: 100, Timeout: 30, Counters: true, Comments: true}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("expected %+v, got %+v", expected, opts)
+	}
+
+	opts, err = parseCreateOptions(ipset.TypeBitmapIP, []string{"range", "192.168.0.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.IPFrom.Equal(net.ParseIP("192.168.0.0")) || !opts.IPTo.Equal(net.ParseIP("192.168.0.255")) {
+		t.Errorf("unexpected range %v-%v", opts.IPFrom, opts.IPTo)
+	}
+
+	opts, err = parseCreateOptions(ipset.TypeBitmapPort, []string{"range", "tcp:100-600"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.PortFrom != 100 || opts.PortTo != 600 {
+		t.Errorf("unexpected range %d-%d", opts.PortFrom, opts.PortTo)
+	}
+
+	opts, err = parseCreateOptions(ipset.TypeHashIP, []string{"bitmask", "255.255.0.255"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.BitMask.Equal(net.ParseIP("255.255.0.255")) {
+		t.Errorf("unexpected bitmask %v", opts.BitMask)
+	}
+
+	if _, err := parseCreateOptions(ipset.TypeHashIP, []string{"bogus"}); err == nil {
+		t.Error("expected unknown option to be rejected")
+	}
+}
+
+func TestWriteSave(t *testing.T) {
+	timeout := uint32(300)
+	sets := []ipset.Sets{
+		{
+			SetName:     "foo",
+			TypeName:    ipset.TypeHashIPPort,
+			Family:      ipset.FamilyIPV4,
+			HashSize:    1024,
+			MaxElements: 65536,
+			Timeout:     &timeout,
+			CadtFlags:   ipset.IPSET_FLAG_WITH_COMMENT,
+			Entries: []ipset.Entry{
+				{IP: net.ParseIP("10.0.0.2").To4(), Protocol: ipset.Uint8Ptr(17), Port: ipset.Uint16Ptr(53), Timeout: &timeout, Comment: "dns"},
+				{IP: net.ParseIP("10.0.0.1").To4(), Protocol: ipset.Uint8Ptr(1), Port: ipset.Uint16Ptr(0x0800), Timeout: &timeout},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeSave(&buf, sets, &options{sorted: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `create foo hash:ip,port family inet hashsize 1024 maxelem 65536 timeout 300 comment
+add foo 10.0.0.1,icmp:echo-request timeout 300
+add foo 10.0.0.2,udp:53 timeout 300 comment "dns"
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	// every saved entry must parse back into the same element
+	for _, e := range sets[0].Entries {
+		args, err := splitLine(e.Format(sets[0].TypeName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ipset.ParseEntry(sets[0].TypeName, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Format(sets[0].TypeName) != e.Format(sets[0].TypeName) {
+			t.Errorf("expected %q, got %q", e.Format(sets[0].TypeName), parsed.Format(sets[0].TypeName))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// restoreCommands are the commands accepted in a restore file.
+var restoreCommands = map[string]bool{
+	"create":  true,
+	"add":     true,
+	"del":     true,
+	"destroy": true,
+	"flush":   true,
+	"rename":  true,
+	"swap":    true,
+	"test":    true,
+}
+
+func runRestore(opts *options, args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return usagef("restore does not accept arguments")
+	}
+
+	var in io.Reader = os.Stdin
+	if opts.file != "" {
+		f, err := os.Open(opts.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	return restore(opts, in, out)
+}
+
+func restore(opts *options, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "COMMIT" {
+			continue
+		}
+
+		args, err := splitLine(line)
+		if err != nil {
+			return usagef("Error in line %d: %v", lineNo, err)
+		}
+
+		cmd := findCommand(args[0])
+		if cmd == nil || !restoreCommands[cmd.name] {
+			return usagef("Error in line %d: command %q is not supported in restore mode", lineNo, args[0])
+		}
+		if err := cmd.run(opts, args[1:], out); err != nil {
+			if _, ok := err.(*usageError); ok {
+				return usagef("Error in line %d: %v", lineNo, err)
+			}
+			return fmt.Errorf("Error in line %d: %s", lineNo, errorMessage(err))
+		}
+	}
+	return scanner.Err()
+}
+
+// splitLine splits a restore line into words, honouring double quotes as
+// used around comments.
+func splitLine(line string) ([]string, error) {
+	var (
+		args    []string
+		word    strings.Builder
+		inWord  bool
+		inQuote bool
+	)
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && inQuote && i+1 < len(line):
+			i++
+			word.WriteByte(line[i])
+		case c == '"':
+			inQuote = !inQuote
+			inWord = true
+		case (c == ' ' || c == '\t') && !inQuote:
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
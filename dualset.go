@@ -0,0 +1,199 @@
+package ipset
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DualSet is a logical set of IPv4 and IPv6 entries, kept in the kernel sets
+// name-v4 and name-v6 created with the same options. With Combined, the
+// list:set name holds both halves, so that a single rule can match either
+// family.
+type DualSet struct {
+	h        *Handle
+	name     string
+	typename string
+	options  CreateOptions
+
+	Combined bool
+}
+
+// NewDualSet returns the dual-stack set name of type typename. A nil h uses
+// the package handle. The family of options is ignored.
+func NewDualSet(h *Handle, name, typename string, options CreateOptions) *DualSet {
+	if h == nil {
+		h = pkgHandle
+	}
+	return &DualSet{h: h, name: name, typename: typename, options: options}
+}
+
+// Name returns the name of the dual-stack set, which is the name of the
+// list:set if it is Combined.
+func (d *DualSet) Name() string {
+	return d.name
+}
+
+// Names returns the names of the IPv4 and IPv6 halves.
+func (d *DualSet) Names() (v4, v6 string) {
+	return DualStackNames(d.name)
+}
+
+// Create creates both halves, and the list:set holding them if the set is
+// Combined.
+func (d *DualSet) Create() error {
+	v4, v6 := d.Names()
+	// with Replace, existing sets are kept and must survive a rollback
+	existed := make(map[string]bool)
+	if d.options.Replace && d.Combined {
+		for _, name := range []string{d.name, v4, v6} {
+			_, err := d.h.Header(name)
+			existed[name] = err == nil
+		}
+	}
+
+	if err := d.h.CreateDualStack(d.name, d.typename, d.options); err != nil {
+		return err
+	}
+	if !d.Combined {
+		return nil
+	}
+
+	err := d.h.Create(d.name, TypeListSet, CreateOptions{Replace: d.options.Replace})
+	if err == nil {
+		err = d.h.AddBatch(d.name, []*Entry{{Name: v4}, {Name: v6}})
+	}
+	if err != nil {
+		for _, name := range []string{d.name, v4, v6} {
+			if !existed[name] {
+				d.h.Destroy(name)
+			}
+		}
+	}
+	return err
+}
+
+// Destroy destroys the list:set if the set is Combined, then both halves.
+func (d *DualSet) Destroy() error {
+	if d.Combined {
+		if err := d.h.Destroy(d.name); err != nil && !isNotExist(err) {
+			return err
+		}
+	}
+	return d.h.DestroyDualStack(d.name)
+}
+
+// Check returns an error if a half is missing, is not of the type of the set
+// or was created with options different from the other half.
+func (d *DualSet) Check() error {
+	v4, v6 := d.Names()
+	var headers [2][]string
+	for i, name := range []string{v4, v6} {
+		set, err := d.h.List(name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if set.TypeName != d.typename {
+			return fmt.Errorf("%s: type %s, expected %s", name, set.TypeName, d.typename)
+		}
+		headers[i] = withoutFamily(set.HeaderOptions())
+	}
+
+	if a, b := strings.Join(headers[0], " "), strings.Join(headers[1], " "); a != b {
+		return fmt.Errorf("%s and %s differ: %q and %q", v4, v6, a, b)
+	}
+	return nil
+}
+
+func withoutFamily(opts []string) []string {
+	for i := 0; i+1 < len(opts); i++ {
+		if opts[i] == "family" {
+			return append(opts[:i:i], opts[i+2:]...)
+		}
+	}
+	return opts
+}
+
+// Add adds entry to the half matching its family.
+func (d *DualSet) Add(entry *Entry) error {
+	return d.h.AddDualStack(d.name, entry)
+}
+
+// Del deletes entry from the half matching its family.
+func (d *DualSet) Del(entry *Entry) error {
+	return d.h.DelDualStack(d.name, entry)
+}
+
+// Test tests whether entry is in the half matching its family.
+func (d *DualSet) Test(entry *Entry) (bool, error) {
+	return d.h.TestDualStack(d.name, entry)
+}
+
+// List returns the entries of both halves, IPv4 first.
+func (d *DualSet) List() ([]Entry, error) {
+	v4, v6 := d.Names()
+	var entries []Entry
+	for _, name := range []string{v4, v6} {
+		set, err := d.h.List(name)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, set.Entries...)
+	}
+	return entries, nil
+}
+
+// Sync makes entries the content of the set: entries missing from their
+// half, or whose options differ, are added and the others are deleted.
+func (d *DualSet) Sync(entries []*Entry) error {
+	v4, v6 := d.Names()
+	desired := map[string][]*Entry{v4: nil, v6: nil}
+	for _, entry := range entries {
+		name, err := DualStackName(d.name, entry)
+		if err != nil {
+			return err
+		}
+		desired[name] = append(desired[name], entry)
+	}
+
+	for _, name := range []string{v4, v6} {
+		set, err := d.h.List(name)
+		if err != nil {
+			return err
+		}
+
+		current := make(map[string]*Entry, len(set.Entries))
+		for i := range set.Entries {
+			current[set.Entries[i].Elem(d.typename)] = &set.Entries[i]
+		}
+
+		// the batches are split to fit netlink messages
+		var adds, dels []*Entry
+		for _, entry := range desired[name] {
+			elem := entry.Elem(d.typename)
+			if e, ok := current[elem]; !ok || !sameOptions(e, entry) {
+				adds = append(adds, entry)
+			}
+			delete(current, elem)
+		}
+		for _, e := range current {
+			dels = append(dels, e)
+		}
+
+		if err := d.h.DelBatch(name, dels); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := d.h.AddBatch(name, adds); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// sameOptions reports whether the options of entry a, ignoring its
+// timeout and counters, are those of b.
+func sameOptions(a, b *Entry) bool {
+	x, y := *a, *b
+	x.Timeout, x.TTL, x.Packets, x.Bytes = nil, nil, nil, nil
+	y.Timeout, y.TTL, y.Packets, y.Bytes = nil, nil, nil, nil
+	return strings.Join(x.Options(), " ") == strings.Join(y.Options(), " ")
+}
@@ -0,0 +1,97 @@
+package ipset
+
+import (
+	"fmt"
+)
+
+// The suffixes of the halves of a dual-stack set.
+const (
+	DualStackSuffixV4 = "-v4"
+	DualStackSuffixV6 = "-v6"
+)
+
+// DualStackNames returns the names of the IPv4 and IPv6 halves of the
+// dual-stack set name.
+func DualStackNames(name string) (v4, v6 string) {
+	return name + DualStackSuffixV4, name + DualStackSuffixV6
+}
+
+// DualStackName returns the half of the dual-stack set name holding entry.
+func DualStackName(name string, entry *Entry) (string, error) {
+	switch entry.Family() {
+	case FamilyIPV4:
+		return name + DualStackSuffixV4, nil
+	case FamilyIPV6:
+		return name + DualStackSuffixV6, nil
+	}
+	return "", fmt.Errorf("entry has no ip address to choose a half of %s", name)
+}
+
+// CreateDualStack creates the sets name-v4 and name-v6 of family inet and
+// inet6, with the same options. The family of options is ignored.
+func (h *Handle) CreateDualStack(name, typename string, options CreateOptions) error {
+	v4, v6 := DualStackNames(name)
+	if len(v6) >= IPSET_MAXNAMELEN {
+		return fmt.Errorf("set name %q is longer than %d characters", v6, IPSET_MAXNAMELEN-1)
+	}
+
+	// with Replace, an existing half is kept and must survive a rollback
+	existed := false
+	if options.Replace {
+		_, err := h.Header(v4)
+		existed = err == nil
+	}
+
+	options.Family = FamilyIPV4
+	if err := h.Create(v4, typename, options); err != nil {
+		return err
+	}
+	options.Family = FamilyIPV6
+	if err := h.Create(v6, typename, options); err != nil {
+		if !existed {
+			h.Destroy(v4)
+		}
+		return err
+	}
+	return nil
+}
+
+// DestroyDualStack destroys both halves of the dual-stack set name.
+func (h *Handle) DestroyDualStack(name string) error {
+	v4, v6 := DualStackNames(name)
+	err := h.Destroy(v4)
+	if err6 := h.Destroy(v6); err == nil {
+		err = err6
+	}
+	return err
+}
+
+// AddDualStack adds entry to the half of the dual-stack set name matching
+// its family.
+func (h *Handle) AddDualStack(name string, entry *Entry) error {
+	setname, err := DualStackName(name, entry)
+	if err != nil {
+		return err
+	}
+	return h.Add(setname, entry)
+}
+
+// DelDualStack deletes entry from the half of the dual-stack set name
+// matching its family.
+func (h *Handle) DelDualStack(name string, entry *Entry) error {
+	setname, err := DualStackName(name, entry)
+	if err != nil {
+		return err
+	}
+	return h.Del(setname, entry)
+}
+
+// TestDualStack tests whether entry is in the half of the dual-stack set name
+// matching its family.
+func (h *Handle) TestDualStack(name string, entry *Entry) (bool, error) {
+	setname, err := DualStackName(name, entry)
+	if err != nil {
+		return false, err
+	}
+	return h.Test(setname, entry)
+}
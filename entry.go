@@ -0,0 +1,387 @@
+package ipset
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// FamilyName returns the name ipset uses for a protocol family.
+func FamilyName(family uint8) string {
+	switch family {
+	case FamilyIPV4:
+		return "inet"
+	case FamilyIPV6:
+		return "inet6"
+	}
+	return "unspec"
+}
+
+// ParseFamily parses a family name as returned by FamilyName.
+func ParseFamily(s string) (uint8, error) {
+	switch s {
+	case "inet", "ipv4", "-4":
+		return FamilyIPV4, nil
+	case "inet6", "ipv6", "-6":
+		return FamilyIPV6, nil
+	}
+	return FamilyUnspec, fmt.Errorf("invalid family: %q", s)
+}
+
+// Family returns the family of the addresses of the entry, or FamilyUnspec
+// if it has none.
+func (e *Entry) Family() uint8 {
+	for _, ip := range []net.IP{e.IP, e.IP2} {
+		if ip == nil {
+			continue
+		}
+		if ip.To4() != nil {
+			return FamilyIPV4
+		}
+		return FamilyIPV6
+	}
+	return FamilyUnspec
+}
+
+// Dimensions returns the element components of a set type, e.g. "ip",
+// "port" and "net" for hash:ip,port,net.
+func (t TypeName) Dimensions() []string {
+	idx := strings.IndexByte(string(t), ':')
+	if idx < 0 {
+		return nil
+	}
+	return strings.Split(string(t)[idx+1:], ",")
+}
+
+// ParseEntry parses an element of a set of type typename, followed by its
+// options, in the syntax of the ipset utility. For example:
+//
+//	ParseEntry(TypeHashIPPort, "10.0.0.1,udp:53", "timeout", "60", "comment", "dns")
+func ParseEntry(typename string, args ...string) (*Entry, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing element")
+	}
+
+	entry := &Entry{}
+	dims := TypeName(typename).Dimensions()
+	parts := strings.Split(args[0], ",")
+	if len(dims) == 0 || len(parts) != len(dims) {
+		return nil, fmt.Errorf("invalid element %q for type %s", args[0], typename)
+	}
+
+	second := false
+	for i, dim := range dims {
+		var err error
+		part := parts[i]
+		switch dim {
+		case "ip", "net":
+			if second {
+				entry.IP2, entry.CIDR2, _, err = parseIPElem(part, false)
+			} else {
+				entry.IP, entry.CIDR, entry.IPTo, err = parseIPElem(part, true)
+			}
+			second = true
+		case "port":
+			if TypeName(typename).Method() == "bitmap" {
+				err = entry.parseBitmapPort(part)
+			} else {
+				err = entry.ParsePort(part)
+			}
+		case "mac":
+			entry.MAC, err = net.ParseMAC(part)
+		case "iface":
+			entry.IFace = part
+		case "mark":
+			var v uint64
+			v, err = strconv.ParseUint(part, 0, 32)
+			entry.Mark = Uint32Ptr(uint32(v))
+		case "set":
+			entry.Name = part
+		default:
+			err = fmt.Errorf("unsupported element component %q", dim)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := entry.parseOptions(args[1:]); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func parseIPElem(s string, allowRange bool) (ip net.IP, cidr uint8, ipTo net.IP, err error) {
+	if idx := strings.IndexByte(s, '-'); idx >= 0 && allowRange {
+		ip, ipTo = parseIP(s[:idx]), parseIP(s[idx+1:])
+		if ip == nil || ipTo == nil || len(ip) != len(ipTo) {
+			return nil, 0, nil, fmt.Errorf("invalid ip range: %q", s)
+		}
+		return ip, 0, ipTo, nil
+	}
+
+	if idx := strings.IndexByte(s, '/'); idx >= 0 {
+		v, err := strconv.ParseUint(s[idx+1:], 10, 8)
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("invalid cidr: %q", s)
+		}
+		cidr, s = uint8(v), s[:idx]
+	}
+
+	ip = parseIP(s)
+	if ip == nil {
+		return nil, 0, nil, fmt.Errorf("invalid ip address: %q", s)
+	}
+	if int(cidr) > len(ip)*8 {
+		return nil, 0, nil, fmt.Errorf("invalid cidr: %d", cidr)
+	}
+	return ip, cidr, nil, nil
+}
+
+// parseIP returns an IPv4 address in its 4-byte form.
+func parseIP(s string) net.IP {
+	ip := net.ParseIP(s)
+	if ip4 := ip.To4(); ip4 != nil && !strings.Contains(s, ":") {
+		return ip4
+	}
+	return ip
+}
+
+func (e *Entry) parseBitmapPort(s string) error {
+	var (
+		from, to uint64
+		err      error
+	)
+	if idx := strings.IndexByte(s, '-'); idx >= 0 {
+		to, err = strconv.ParseUint(s[idx+1:], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port: %q", s)
+		}
+		e.PortTo = Uint16Ptr(uint16(to))
+		s = s[:idx]
+	}
+	from, err = strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port: %q", s)
+	}
+	e.Port = Uint16Ptr(uint16(from))
+	return nil
+}
+
+func (e *Entry) parseOptions(args []string) error {
+	for i := 0; i < len(args); i++ {
+		opt := args[i]
+		if opt == "nomatch" {
+			e.NoMatch = true
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return fmt.Errorf("missing value for option %q", opt)
+		}
+		i++
+		val := args[i]
+
+		switch opt {
+		case "timeout":
+			v, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid timeout: %q", val)
+			}
+			e.Timeout = Uint32Ptr(uint32(v))
+		case "packets", "bytes":
+			v, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %q", opt, val)
+			}
+			if opt == "packets" {
+				e.Packets = &v
+			} else {
+				e.Bytes = &v
+			}
+		case "comment":
+			if len(val) > IPSET_MAX_COMMENT_SIZE {
+				return fmt.Errorf("comment is longer than %d bytes", IPSET_MAX_COMMENT_SIZE)
+			}
+			e.Comment = val
+		case "skbmark":
+			mark, mask := val, "0xffffffff"
+			if idx := strings.IndexByte(val, '/'); idx >= 0 {
+				mark, mask = val[:idx], val[idx+1:]
+			}
+			m, err := strconv.ParseUint(mark, 0, 32)
+			if err != nil {
+				return fmt.Errorf("invalid skbmark: %q", val)
+			}
+			k, err := strconv.ParseUint(mask, 0, 32)
+			if err != nil {
+				return fmt.Errorf("invalid skbmark: %q", val)
+			}
+			e.SkbMark, e.SkbMask = Uint32Ptr(uint32(m)), Uint32Ptr(uint32(k))
+		case "skbprio":
+			idx := strings.IndexByte(val, ':')
+			if idx < 0 {
+				return fmt.Errorf("invalid skbprio: %q", val)
+			}
+			major, err := strconv.ParseUint(val[:idx], 16, 16)
+			if err != nil {
+				return fmt.Errorf("invalid skbprio: %q", val)
+			}
+			minor, err := strconv.ParseUint(val[idx+1:], 16, 16)
+			if err != nil {
+				return fmt.Errorf("invalid skbprio: %q", val)
+			}
+			e.SkbPrio = Uint32Ptr(uint32(major<<16 | minor))
+		case "skbqueue":
+			v, err := strconv.ParseUint(val, 10, 16)
+			if err != nil {
+				return fmt.Errorf("invalid skbqueue: %q", val)
+			}
+			e.SkbQueue = Uint16Ptr(uint16(v))
+		default:
+			return fmt.Errorf("unknown option %q", opt)
+		}
+	}
+	return nil
+}
+
+// Elem returns the element of the entry in the syntax of the ipset utility,
+// without any options.
+func (e *Entry) Elem(typename string) string {
+	dims := TypeName(typename).Dimensions()
+	parts := make([]string, 0, len(dims))
+
+	second := false
+	for _, dim := range dims {
+		switch dim {
+		case "ip", "net":
+			if second {
+				parts = append(parts, formatIPElem(e.IP2, e.CIDR2, nil))
+			} else {
+				parts = append(parts, formatIPElem(e.IP, e.CIDR, e.IPTo))
+			}
+			second = true
+		case "port":
+			if e.Port == nil {
+				parts = append(parts, "")
+			} else if TypeName(typename).Method() == "bitmap" {
+				parts = append(parts, strconv.Itoa(int(*e.Port)))
+			} else {
+				parts = append(parts, e.PortString())
+			}
+		case "mac":
+			parts = append(parts, e.MAC.String())
+		case "iface":
+			parts = append(parts, e.IFace)
+		case "mark":
+			if e.Mark != nil {
+				parts = append(parts, fmt.Sprintf("0x%08x", *e.Mark))
+			} else {
+				parts = append(parts, "")
+			}
+		case "set":
+			parts = append(parts, e.Name)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatIPElem(ip net.IP, cidr uint8, ipTo net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	s := ip.String()
+	if ipTo != nil {
+		return s + "-" + ipTo.String()
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		bits = 8 * net.IPv4len
+	}
+	if cidr != 0 && int(cidr) != bits {
+		s += "/" + strconv.Itoa(int(cidr))
+	}
+	return s
+}
+
+// Options returns the options of the entry (timeout, counters, comment,
+// skbinfo, nomatch) as printed by the ipset utility.
+func (e *Entry) Options() []string {
+	var opts []string
+	if e.Timeout != nil {
+		opts = append(opts, "timeout", strconv.FormatUint(uint64(*e.Timeout), 10))
+	}
+	if e.Packets != nil {
+		opts = append(opts, "packets", strconv.FormatUint(*e.Packets, 10))
+	}
+	if e.Bytes != nil {
+		opts = append(opts, "bytes", strconv.FormatUint(*e.Bytes, 10))
+	}
+	if e.Comment != "" {
+		opts = append(opts, "comment", strconv.Quote(e.Comment))
+	}
+	if e.SkbMark != nil {
+		mark := fmt.Sprintf("0x%x", *e.SkbMark)
+		if e.SkbMask != nil && *e.SkbMask != 0xffffffff {
+			mark += fmt.Sprintf("/0x%x", *e.SkbMask)
+		}
+		opts = append(opts, "skbmark", mark)
+	}
+	if e.SkbPrio != nil {
+		opts = append(opts, "skbprio", fmt.Sprintf("%x:%x", *e.SkbPrio>>16, *e.SkbPrio&0xffff))
+	}
+	if e.SkbQueue != nil {
+		opts = append(opts, "skbqueue", strconv.Itoa(int(*e.SkbQueue)))
+	}
+	if e.NoMatch {
+		opts = append(opts, "nomatch")
+	}
+	return opts
+}
+
+// Format returns the entry as listed by the ipset utility: the element
+// followed by its options.
+func (e *Entry) Format(typename string) string {
+	return strings.Join(append([]string{e.Elem(typename)}, e.Options()...), " ")
+}
+
+// HeaderOptions returns the create options of the set as printed in the
+// "Header:" line of the ipset utility, e.g. "family", "inet", "hashsize",
+// "1024", "maxelem", "65536", "counters".
+func (s *Sets) HeaderOptions() []string {
+	var opts []string
+
+	switch TypeName(s.TypeName).Method() {
+	case "hash":
+		if s.TypeName != TypeHashMac {
+			opts = append(opts, "family", FamilyName(s.Family))
+		}
+		opts = append(opts, "hashsize", strconv.Itoa(int(s.HashSize)))
+		opts = append(opts, "maxelem", strconv.Itoa(int(s.MaxElements)))
+		if s.NetMask != 0 {
+			opts = append(opts, "netmask", strconv.Itoa(int(s.NetMask)))
+		} else if s.BitMask != nil {
+			opts = append(opts, "bitmask", s.BitMask.String())
+		}
+	case "bitmap":
+		if s.TypeName == TypeBitmapPort {
+			opts = append(opts, "range", fmt.Sprintf("%d-%d", s.PortFrom, s.PortTo))
+		} else if s.IPFrom != nil && s.IPTo != nil {
+			opts = append(opts, "range", s.IPFrom.String()+"-"+s.IPTo.String())
+		}
+		if s.NetMask != 0 {
+			opts = append(opts, "netmask", strconv.Itoa(int(s.NetMask)))
+		}
+	case "list":
+		opts = append(opts, "size", strconv.Itoa(int(s.Size)))
+	}
+
+	if s.TypeName == TypeHashIPMark {
+		opts = append(opts, "markmask", fmt.Sprintf("0x%08x", s.MarkMask))
+	}
+	if s.Timeout != nil {
+		opts = append(opts, "timeout", strconv.Itoa(int(*s.Timeout)))
+	}
+	return append(opts, cadtFlagsToNames(s.CadtFlags)...)
+}
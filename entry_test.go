@@ -0,0 +1,72 @@
+package ipset
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseEntryFormat(t *testing.T) {
+	testCases := []struct {
+		typename string
+		args     []string
+		output   string
+	}{
+		{TypeHashIP, []string{"10.0.0.1"}, "10.0.0.1"},
+		{TypeHashIP, []string{"10.0.0.1-10.0.0.9", "timeout", "5"}, "10.0.0.1-10.0.0.9 timeout 5"},
+		{TypeHashNet, []string{"10.0.0.0/8", "nomatch"}, "10.0.0.0/8 nomatch"},
+		{TypeHashNet, []string{"2001:db8::/32"}, "2001:db8::/32"},
+		{TypeHashNetNet, []string{"10.0.0.0/24,192.168.0.0/16"}, "10.0.0.0/24,192.168.0.0/16"},
+		{TypeHashIPPortIP, []string{"10.0.0.1,udp:53,10.0.0.2"}, "10.0.0.1,udp:53,10.0.0.2"},
+		{TypeHashNetIface, []string{"10.0.0.0/16,eth0"}, "10.0.0.0/16,eth0"},
+		{TypeHashIPMark, []string{"10.0.0.1,0x10"}, "10.0.0.1,0x00000010"},
+		{TypeHashMac, []string{"de:ad:00:00:be:ef", "packets", "3", "bytes", "120"}, "de:ad:00:00:be:ef packets 3 bytes 120"},
+		{TypeBitmapPort, []string{"80"}, "80"},
+		{TypeListSet, []string{"foo", "comment", "a b"}, `foo comment "a b"`},
+		{TypeHashIP, []string{"10.0.0.1", "skbmark", "0x10/0xff", "skbprio", "1:2", "skbqueue", "3"}, "10.0.0.1 skbmark 0x10/0xff skbprio 1:2 skbqueue 3"},
+	}
+
+	for _, tC := range testCases {
+		entry, err := ParseEntry(tC.typename, tC.args...)
+		if err != nil {
+			t.Fatalf("%s %v: %v", tC.typename, tC.args, err)
+		}
+		if s := entry.Format(tC.typename); s != tC.output {
+			t.Errorf("%s %v: expected %q, got %q", tC.typename, tC.args, tC.output, s)
+		}
+	}
+
+	invalid := []struct {
+		typename string
+		args     []string
+	}{
+		{TypeHashIP, nil},
+		{TypeHashIP, []string{"10.0.0.1,80"}},
+		{TypeHashNet, []string{"10.0.0.0/33"}},
+		{TypeHashIP, []string{"10.0.0.1", "timeout"}},
+		{TypeHashIP, []string{"10.0.0.1", "bogus", "1"}},
+		{TypeHashMac, []string{"not-a-mac"}},
+	}
+	for _, tC := range invalid {
+		if _, err := ParseEntry(tC.typename, tC.args...); err == nil {
+			t.Errorf("%s %v: expected an error", tC.typename, tC.args)
+		}
+	}
+}
+
+func TestEntryFamily(t *testing.T) {
+	testCases := []struct {
+		entry  Entry
+		family uint8
+	}{
+		{Entry{IP: net.ParseIP("10.0.0.1")}, FamilyIPV4},
+		{Entry{IP: net.ParseIP("10.0.0.1").To4()}, FamilyIPV4},
+		{Entry{IP: net.ParseIP("2001:db8::1")}, FamilyIPV6},
+		{Entry{IP2: net.ParseIP("2001:db8::1")}, FamilyIPV6},
+		{Entry{Name: "foo"}, FamilyUnspec},
+	}
+	for _, tc := range testCases {
+		if family := tc.entry.Family(); family != tc.family {
+			t.Errorf("%v: expected family %d, got %d", tc.entry, tc.family, family)
+		}
+	}
+}
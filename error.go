@@ -25,6 +25,7 @@
 	IPSET_ERR_COMMENT
 	IPSET_ERR_INVALID_MARKMASK
 	IPSET_ERR_SKBINFO
+	IPSET_ERR_BITMASK_NETMASK_EXCL
 
 	/* Type specific error codes */
 	IPSET_ERR_TYPE_SPECIFIC = 4352
@@ -33,7 +34,7 @@
 /* Bitmap type specific error codes */
 const (
 	/* The element is out of the range of the set */
-	IPSET_ERR_BITMAP_RANGE = IPSET_ERR_TYPE_SPECIFIC + 1 + iota
+	IPSET_ERR_BITMAP_RANGE = IPSET_ERR_TYPE_SPECIFIC + iota
 	/* The range exceeds the size limit of the set type */
 	IPSET_ERR_BITMAP_RANGE_SIZE
 )
@@ -41,7 +42,7 @@
 /* Hash type specific error codes */
 const (
 	/* Hash is full */
-	IPSET_ERR_HASH_FULL = IPSET_ERR_TYPE_SPECIFIC + 1 + iota
+	IPSET_ERR_HASH_FULL = IPSET_ERR_TYPE_SPECIFIC + iota
 	/* Null-valued element */
 	IPSET_ERR_HASH_ELEM
 	/* Invalid protocol */
@@ -56,8 +57,10 @@
 
 /* List type specific error codes */
 const (
+	/* Set name to be added/deleted/tested does not exist */
+	IPSET_ERR_NAME = IPSET_ERR_TYPE_SPECIFIC + iota
 	/* list:set type is not permitted to add */
-	IPSET_ERR_LOOP = IPSET_ERR_TYPE_SPECIFIC + 1 + iota
+	IPSET_ERR_LOOP
 	/* Missing reference set */
 	IPSET_ERR_BEFORE
 	/* Reference set does not exist */
@@ -110,6 +113,8 @@ func (e IPSetError) Error() string {
 		return "invalid markmask"
 	case IPSET_ERR_SKBINFO:
 		return "skbinfo"
+	case IPSET_ERR_BITMASK_NETMASK_EXCL:
+		return "bitmask and netmask are mutually exclusive"
 	default:
 		return "errno " + strconv.Itoa(int(e))
 	}
@@ -186,6 +191,9 @@ func (e IPSetError) Error() string {
 const (
 	// ErrEntryExist Element cannot be added to the set: it's already added
 	ErrEntryExist = IPSetError(IPSET_ERR_EXIST)
+	// ErrHashFull Element cannot be added to the hash set: it reached maxelem.
+	// The code is shared with the type specific errors of other types.
+	ErrHashFull = IPSetError(IPSET_ERR_HASH_FULL)
 )
 
 /* DEL specific error codes */
@@ -0,0 +1,86 @@
+package ipset
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// MaxRangeHosts is the most addresses a range is expanded into for types
+// storing addresses rather than networks.
+const MaxRangeHosts = 65536
+
+// RangeToPrefixes returns the shortest list of networks covering exactly
+// the addresses from through to. The whole address space is returned as its
+// two /1 halves, which sets can store.
+func RangeToPrefixes(from, to netip.Addr) ([]netip.Prefix, error) {
+	from, to = from.Unmap(), to.Unmap()
+	if !from.IsValid() || !to.IsValid() || from.BitLen() != to.BitLen() {
+		return nil, fmt.Errorf("invalid range %s-%s", from, to)
+	}
+	if to.Less(from) {
+		return nil, fmt.Errorf("range %s-%s is reversed", from, to)
+	}
+	return addrRange{from, to}.prefixes(), nil
+}
+
+// RangeToCIDRs returns the shortest list of networks covering exactly the
+// addresses from through to.
+func RangeToCIDRs(from, to net.IP) ([]*net.IPNet, error) {
+	f, ok := toAddr(from)
+	if !ok {
+		return nil, fmt.Errorf("invalid ip address: %v", from)
+	}
+	t, ok := toAddr(to)
+	if !ok {
+		return nil, fmt.Errorf("invalid ip address: %v", to)
+	}
+	prefixes, err := RangeToPrefixes(f, t)
+	if err != nil {
+		return nil, err
+	}
+	cidrs := make([]*net.IPNet, len(prefixes))
+	for i, p := range prefixes {
+		cidrs[i] = &net.IPNet{IP: p.Addr().AsSlice(), Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen())}
+	}
+	return cidrs, nil
+}
+
+// ExpandRange returns the entries of a set of type typename covering the
+// range IP-IPTo of entry: networks for types of networks, addresses, at
+// most MaxRangeHosts of them, for types of addresses.
+func ExpandRange(typename string, entry *Entry) ([]*Entry, error) {
+	r, ok := entryRange(entry)
+	if !ok || entry.IPTo == nil {
+		return nil, fmt.Errorf("invalid range %v-%v", entry.IP, entry.IPTo)
+	}
+	dims := TypeName(typename).Dimensions()
+	if len(dims) == 0 || (dims[0] != "ip" && dims[0] != "net") {
+		return nil, fmt.Errorf("type %s has no address to expand", typename)
+	}
+
+	expand := func(p netip.Prefix) *Entry {
+		e := *entry
+		e.IP, e.CIDR, e.IPTo = p.Addr().AsSlice(), uint8(p.Bits()), nil
+		return &e
+	}
+
+	var entries []*Entry
+	if dims[0] == "net" {
+		for _, p := range r.prefixes() {
+			entries = append(entries, expand(p))
+		}
+		return entries, nil
+	}
+
+	for addr := r.from; addr.IsValid() && addr.Compare(r.to) <= 0; addr = addr.Next() {
+		if len(entries) == MaxRangeHosts {
+			return nil, fmt.Errorf("range %s-%s holds more than %d addresses", r.from, r.to, MaxRangeHosts)
+		}
+		e := expand(netip.PrefixFrom(addr, addr.BitLen()))
+		// some types refuse a cidr along with an address
+		e.CIDR = 0
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
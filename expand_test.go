@@ -0,0 +1,62 @@
+package ipset
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestRangeToCIDRs(t *testing.T) {
+	cidrs, err := RangeToCIDRs(net.ParseIP("192.168.0.255"), net.ParseIP("192.168.2.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range cidrs {
+		got = append(got, c.String())
+	}
+	if expected := []string{"192.168.0.255/32", "192.168.1.0/24", "192.168.2.0/32"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	prefixes, err := RangeToPrefixes(netip.MustParseAddr("::"), netip.MustParseAddr("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"))
+	if got := prefixStrings(prefixes); err != nil || !reflect.DeepEqual(got, []string{"::/1", "8000::/1"}) {
+		t.Errorf("unexpected prefixes %v: %v", prefixes, err)
+	}
+
+	for _, r := range [][2]string{{"10.0.0.2", "10.0.0.1"}, {"10.0.0.1", "2001:db8::1"}} {
+		if _, err := RangeToPrefixes(netip.MustParseAddr(r[0]), netip.MustParseAddr(r[1])); err == nil {
+			t.Errorf("expected %s-%s to be invalid", r[0], r[1])
+		}
+	}
+}
+
+func TestExpandRange(t *testing.T) {
+	entry, err := ParseEntry(TypeHashNetPort, "2001:db8::-2001:db8::2,tcp:80", "comment", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ExpandRange(TypeHashNetPort, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Format(TypeHashNetPort))
+	}
+	if expected := []string{`2001:db8::/127,tcp:80 comment "web"`, `2001:db8::2,tcp:80 comment "web"`}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	entries, err = ExpandRange(TypeHashIP, &Entry{IP: net.ParseIP("2001:db8::"), IPTo: net.ParseIP("2001:db8::2")})
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("expected 3 addresses, got %d: %v", len(entries), err)
+	}
+	if _, err := ExpandRange(TypeHashIP, &Entry{IP: net.ParseIP("2001:db8::"), IPTo: net.ParseIP("2001:db8::1:0")}); err == nil {
+		t.Error("expected a range of more than MaxRangeHosts addresses to be refused")
+	}
+	if _, err := ExpandRange(TypeListSet, &Entry{IP: net.ParseIP("10.0.0.1"), IPTo: net.ParseIP("10.0.0.2")}); err == nil {
+		t.Error("expected list:set to be refused")
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/lrh3321/ipset-go
 
-go 1.16
+go 1.18
 
 require (
 	github.com/vishvananda/netlink v1.2.1-beta.2
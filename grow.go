@@ -0,0 +1,159 @@
+package ipset
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// GrowPolicy makes Add and AddBatch grow a hash set which is full, by
+// recreating it with a larger maxelem, copying its entries and swapping it
+// in. Rules referencing the set keep using it. The set is not locked while
+// it is copied: entries other writers add meanwhile are lost and entries
+// they delete reappear.
+type GrowPolicy struct {
+	Factor uint32 // maxelem is multiplied by Factor, 2 if zero
+	Limit  uint32 // the largest maxelem, unlimited if zero
+
+	// OnGrow, if not nil, is called after each attempt to grow a set.
+	OnGrow func(GrowEvent)
+}
+
+// GrowEvent reports a set grown by a GrowPolicy.
+type GrowEvent struct {
+	SetName        string
+	OldMaxElements uint32
+	NewMaxElements uint32
+	Entries        int   // entries copied
+	Err            error // the set was not grown if not nil
+}
+
+// growSuffix starts the suffix of the set a set is grown into.
+const growSuffix = ".grow-"
+
+// nextMaxElements returns the maxelem a set grows to from maxelem, or 0 if
+// it reached the limit.
+func (p *GrowPolicy) nextMaxElements(maxelem uint32) uint32 {
+	factor := uint64(p.Factor)
+	if factor < 2 {
+		factor = 2
+	}
+	limit := uint64(p.Limit)
+	if limit == 0 {
+		limit = 1<<32 - 1
+	}
+	if uint64(maxelem) >= limit {
+		return 0
+	}
+	next := uint64(maxelem) * factor
+	if next > limit {
+		next = limit
+	}
+	return uint32(next)
+}
+
+// growName returns the name of the temporary set setname is grown into,
+// made unique by token.
+func growName(setname, token string) string {
+	if max := IPSET_MAXNAMELEN - 1 - len(growSuffix) - len(token); len(setname) > max {
+		setname = setname[:max]
+	}
+	return setname + growSuffix + token
+}
+
+// newGrowName returns a random temporary name to grow setname into.
+func newGrowName(setname string) (string, error) {
+	token := make([]byte, 3)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return growName(setname, hex.EncodeToString(token)), nil
+}
+
+// SetGrowPolicy sets the policy of growing full hash sets. A nil policy, the
+// default, leaves Add failing with ErrHashFull.
+func (h *Handle) SetGrowPolicy(p *GrowPolicy) {
+	h.grow.Store(growPolicyValue{p})
+}
+
+// growPolicyValue wraps a possibly nil policy to store it in an
+// atomic.Value.
+type growPolicyValue struct {
+	*GrowPolicy
+}
+
+func (h *Handle) growPolicy() *GrowPolicy {
+	p, _ := h.grow.Load().(growPolicyValue)
+	return p.GrowPolicy
+}
+
+// Grow recreates the hash set setname with maxelem, copying its entries,
+// and swaps it in.
+func (h *Handle) Grow(setname string, maxelem uint32) error {
+	set, err := h.List(setname)
+	if err != nil {
+		return err
+	}
+	_, err = h.growSet(set, maxelem)
+	return err
+}
+
+// growSet grows the listed set to maxelem and returns the number of entries
+// copied.
+func (h *Handle) growSet(set *Sets, maxelem uint32) (copied int, err error) {
+	setname := set.SetName
+	if TypeName(set.TypeName).Method() != "hash" {
+		return 0, fmt.Errorf("set %s of type %s cannot grow", setname, set.TypeName)
+	}
+
+	opts := set.CreateOptions()
+	opts.MaxElements = maxelem
+	opts.Replace = false
+	tmp, err := newGrowName(setname)
+	if err != nil {
+		return 0, err
+	}
+	// never take over a set of the same name
+	if err := h.Create(tmp, set.TypeName, opts); err != nil {
+		return 0, fmt.Errorf("create %s: %w", tmp, err)
+	}
+	if copied, err = h.copyEntries(tmp, set.Entries); err != nil {
+		h.Destroy(tmp)
+		return copied, err
+	}
+
+	if err := h.Swap(setname, tmp); err != nil {
+		h.Destroy(tmp)
+		return copied, err
+	}
+	return copied, h.Destroy(tmp)
+}
+
+// growOnFull grows setname if err reports it full and a policy is set, and
+// reports whether the add should be retried.
+func (h *Handle) growOnFull(setname string, err error) bool {
+	p := h.growPolicy()
+	if p == nil || err != ErrHashFull {
+		return false
+	}
+	// the code is shared with other types
+	set, lerr := h.Header(setname)
+	if lerr != nil || TypeName(set.TypeName).Method() != "hash" {
+		return false
+	}
+	// the header does not carry maxelem
+	if set, lerr = h.List(setname); lerr != nil {
+		return false
+	}
+
+	event := GrowEvent{SetName: setname, OldMaxElements: set.MaxElements}
+	if event.NewMaxElements = p.nextMaxElements(set.MaxElements); event.NewMaxElements == 0 {
+		event.Err = fmt.Errorf("set %s reached the maxelem limit %d", setname, set.MaxElements)
+	} else {
+		event.Entries, event.Err = h.growSet(set, event.NewMaxElements)
+	}
+	if p.OnGrow != nil {
+		p.OnGrow(event)
+	}
+	return event.Err == nil
+}
@@ -0,0 +1,46 @@
+package ipset
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNextMaxElements(t *testing.T) {
+	for _, tc := range []struct {
+		policy  GrowPolicy
+		maxelem uint32
+		next    uint32
+	}{
+		{GrowPolicy{}, 1024, 2048},
+		{GrowPolicy{Factor: 4}, 1024, 4096},
+		{GrowPolicy{Limit: 3000}, 2048, 3000},
+		{GrowPolicy{Limit: 3000}, 3000, 0},
+		{GrowPolicy{}, 1 << 31, 1<<32 - 1},
+		{GrowPolicy{}, 1<<32 - 1, 0},
+	} {
+		if next := tc.policy.nextMaxElements(tc.maxelem); next != tc.next {
+			t.Errorf("%+v from %d: expected %d, got %d", tc.policy, tc.maxelem, tc.next, next)
+		}
+	}
+}
+
+func TestGrowName(t *testing.T) {
+	if name := growName("blocklist", "0a1b2c"); name != "blocklist.grow-0a1b2c" {
+		t.Errorf("unexpected name %q", name)
+	}
+	if name := growName(strings.Repeat("x", IPSET_MAXNAMELEN-1), "0a1b2c"); len(name) != IPSET_MAXNAMELEN-1 || !strings.HasSuffix(name, growSuffix+"0a1b2c") {
+		t.Errorf("unexpected name %q", name)
+	}
+
+	a, err := newGrowName("blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newGrowName("blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b || !strings.HasPrefix(a, "blocklist"+growSuffix) {
+		t.Errorf("expected distinct temporary names, got %q and %q", a, b)
+	}
+}
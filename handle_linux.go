@@ -1,8 +1,10 @@
 package ipset
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -20,9 +22,17 @@
 // same netlink family share the same netlink socket,
 // which gets released when the handle is deleted.
 type Handle struct {
-	socket *nl.SocketHandle
+	socket   *nl.SocketHandle
+	borrowed bool   // socket is owned by the caller of NewHandleFromSocket
+	protocol uint32 // negotiated protocol version, accessed atomically
+	grow     atomic.Value
+	trace    atomic.Value
 }
 
+// ErrNoNetfilterSocket is returned when a socket is not a NETLINK_NETFILTER
+// socket.
+var ErrNoNetfilterSocket = errors.New("ipset: not a netfilter netlink socket")
+
 // SetSocketTimeout configures timeout for default netlink sockets
 func SetSocketTimeout(to time.Duration) error {
 	if to < time.Microsecond {
@@ -117,16 +127,71 @@ func NewHandleAtFrom(newNs, curNs netns.NsHandle) (*Handle, error) {
 	return newHandle(newNs, curNs)
 }
 
+// NewHandleFromSocket returns a handle sending its requests on an existing
+// NETLINK_NETFILTER socket, e.g. one shared with another netlink library.
+// Closing the handle leaves the socket open.
+func NewHandleFromSocket(sh *nl.SocketHandle) (*Handle, error) {
+	if sh == nil || sh.Socket == nil {
+		return nil, ErrNoNetfilterSocket
+	}
+	proto, err := unix.GetsockoptInt(sh.Socket.GetFd(), unix.SOL_SOCKET, unix.SO_PROTOCOL)
+	if err != nil {
+		return nil, fmt.Errorf("ipset: socket protocol: %w", err)
+	}
+	if proto != unix.NETLINK_NETFILTER {
+		return nil, ErrNoNetfilterSocket
+	}
+	return &Handle{socket: sh, borrowed: true}, nil
+}
+
+// HandleFromNetlinkHandle returns a handle sharing the NETLINK_NETFILTER
+// socket of h, or a handle on the current namespace if h did not open one.
+//
+// Deprecated: it reads private fields of netlink.Handle. Use
+// NewHandleFromSocket or NewHandleFromFd instead.
 func HandleFromNetlinkHandle(h *netlink.Handle) *Handle {
-	val := reflect.ValueOf(h)
-	sockets := val.Elem().FieldByName("sockets")
+	if h == nil {
+		return &Handle{}
+	}
+	sockets := reflect.ValueOf(h).Elem().FieldByName("sockets")
+	if !sockets.IsValid() || sockets.Type() != reflect.TypeOf(map[int]*nl.SocketHandle(nil)) {
+		return &Handle{}
+	}
+	m := *(*map[int]*nl.SocketHandle)(unsafe.Pointer(sockets.UnsafeAddr()))
+	handle, err := NewHandleFromSocket(m[unix.NETLINK_NETFILTER])
+	if err != nil {
+		return &Handle{}
+	}
+	return handle
+}
 
-	ptr := unsafe.Pointer(sockets.UnsafeAddr())
-	sockets2 := *(*map[int]*nl.SocketHandle)(ptr)
-	s := sockets2[unix.NETLINK_NETFILTER]
+// NewHandleFromFd returns a handle on the network namespace of the socket fd,
+// e.g. a socket of a netlink.Handle. The handle opens its own socket.
+func NewHandleFromFd(fd int) (*Handle, error) {
+	ns, err := socketNamespace(fd)
+	if err != nil {
+		return nil, err
+	}
+	defer ns.Close()
+	return NewHandleAt(ns)
+}
 
-	h2 := &Handle{socket: s}
-	return h2
+// Namespace returns the network namespace of the handle, e.g. to create a
+// netlink.Handle with netlink.NewHandleAt on the same namespace. The caller
+// must close it.
+func (h *Handle) Namespace() (netns.NsHandle, error) {
+	if h.socket == nil {
+		return netns.Get()
+	}
+	return socketNamespace(h.socket.Socket.GetFd())
+}
+
+func socketNamespace(fd int) (netns.NsHandle, error) {
+	nsfd, err := unix.IoctlRetInt(fd, unix.SIOCGSKNS)
+	if err != nil {
+		return netns.None(), fmt.Errorf("ipset: namespace of socket %d: %w", fd, err)
+	}
+	return netns.NsHandle(nsfd), nil
 }
 
 func newHandle(newNs, curNs netns.NsHandle) (*Handle, error) {
@@ -140,7 +205,7 @@ func newHandle(newNs, curNs netns.NsHandle) (*Handle, error) {
 
 // Close releases the resources allocated to this handle
 func (h *Handle) Close() {
-	if sh := h.socket; sh != nil {
+	if sh := h.socket; sh != nil && !h.borrowed {
 		sh.Close()
 	}
 	h.socket = nil
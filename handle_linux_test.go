@@ -6,6 +6,8 @@
 	"unsafe"
 
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
 	"golang.org/x/sys/unix"
 )
 
@@ -76,6 +78,39 @@ func TestHandleReceiveBuffer(t *testing.T) {
 	}
 }
 
+func TestNewHandleFromSocket(t *testing.T) {
+	s, err := nl.GetNetlinkSocketAt(netns.None(), netns.None(), unix.NETLINK_NETFILTER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh := &nl.SocketHandle{Socket: s}
+	defer sh.Close()
+
+	h, err := NewHandleFromSocket(sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.socket != sh {
+		t.Fatal("expected the socket to be shared")
+	}
+	h.Close()
+	if _, err := unix.GetsockoptInt(s.GetFd(), unix.SOL_SOCKET, unix.SO_PROTOCOL); err != nil {
+		t.Fatalf("expected the shared socket to stay open: %v", err)
+	}
+
+	if _, err := NewHandleFromSocket(nil); err != ErrNoNetfilterSocket {
+		t.Fatalf("expected ErrNoNetfilterSocket, got %v", err)
+	}
+	route, err := nl.GetNetlinkSocketAt(netns.None(), netns.None(), unix.NETLINK_ROUTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer route.Close()
+	if _, err := NewHandleFromSocket(&nl.SocketHandle{Socket: route}); err != ErrNoNetfilterSocket {
+		t.Fatalf("expected ErrNoNetfilterSocket, got %v", err)
+	}
+}
+
 func TestHandleFromNetlinkHandle(t *testing.T) {
 	netlinkHandle, err := netlink.NewHandle()
 	if err != nil {
@@ -92,6 +127,47 @@ func TestHandleFromNetlinkHandle(t *testing.T) {
 		t.Fatalf("Unexpected number of socket buffer sizes: %d (expected %d)",
 			len(sizes), 1)
 	}
+
+	route, err := netlink.NewHandle(unix.NETLINK_ROUTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer route.Delete()
+	if h := HandleFromNetlinkHandle(route); h.socket != nil {
+		t.Fatal("expected a handle without the route socket")
+	}
+}
+
+func TestNewHandleFromFd(t *testing.T) {
+	route, err := nl.GetNetlinkSocketAt(netns.None(), netns.None(), unix.NETLINK_ROUTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer route.Close()
+
+	h, err := NewHandleFromFd(route.GetFd())
+	if err != nil {
+		t.Skip("SIOCGSKNS is not supported: ", err)
+	}
+	defer h.Close()
+
+	ns, err := h.Namespace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+	cur, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cur.Close()
+	if !ns.Equal(cur) {
+		t.Errorf("expected handle in namespace %s, got %s", cur, ns)
+	}
+
+	if _, err := NewHandleFromFd(-1); err == nil {
+		t.Error("expected an invalid fd to fail")
+	}
 }
 
 func verifySockTimeVal(t *testing.T, fd int, tv unix.Timeval) {
@@ -117,3 +193,21 @@ func verifySockTimeVal(t *testing.T, fd int, tv unix.Timeval) {
 		t.Fatalf("Unexpected timeout value read: %v. Expected: %v", tr, tv)
 	}
 }
+
+func TestProtocolFallback(t *testing.T) {
+	route, err := nl.GetNetlinkSocketAt(netns.None(), netns.None(), unix.NETLINK_ROUTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer route.Close()
+
+	// the negotiation cannot succeed over a route socket
+	h := &Handle{socket: &nl.SocketHandle{Socket: route}}
+	if _, err := h.ProtocolVersion(); err == nil {
+		t.Fatal("expected the negotiation to fail")
+	}
+	h.newRequest(IPSET_CMD_LIST)
+	if protocol, err := h.ProtocolVersion(); err != nil || protocol != IPSET_PROTOCOL {
+		t.Errorf("expected the fallback protocol to be kept, got %d, %v", protocol, err)
+	}
+}
@@ -0,0 +1,278 @@
+package ipset
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type icmpName struct {
+	name string
+	typ  uint8
+	code uint8
+}
+
+// icmpTypeCodes is the ICMP name table used by the ipset utility.
+var icmpTypeCodes = []icmpName{
+	{"echo-reply", 0, 0},
+	{"pong", 0, 0},
+	{"network-unreachable", 3, 0},
+	{"host-unreachable", 3, 1},
+	{"protocol-unreachable", 3, 2},
+	{"port-unreachable", 3, 3},
+	{"fragmentation-needed", 3, 4},
+	{"source-route-failed", 3, 5},
+	{"network-unknown", 3, 6},
+	{"host-unknown", 3, 7},
+	{"network-prohibited", 3, 9},
+	{"host-prohibited", 3, 10},
+	{"TOS-network-unreachable", 3, 11},
+	{"TOS-host-unreachable", 3, 12},
+	{"communication-prohibited", 3, 13},
+	{"host-precedence-violation", 3, 14},
+	{"precedence-cutoff", 3, 15},
+	{"source-quench", 4, 0},
+	{"network-redirect", 5, 0},
+	{"host-redirect", 5, 1},
+	{"TOS-network-redirect", 5, 2},
+	{"TOS-host-redirect", 5, 3},
+	{"echo-request", 8, 0},
+	{"ping", 8, 0},
+	{"router-advertisement", 9, 0},
+	{"router-solicitation", 10, 0},
+	{"ttl-zero-during-transit", 11, 0},
+	{"ttl-zero-during-reassembly", 11, 1},
+	{"ip-header-bad", 12, 0},
+	{"required-option-missing", 12, 1},
+	{"timestamp-request", 13, 0},
+	{"timestamp-reply", 14, 0},
+	{"address-mask-request", 17, 0},
+	{"address-mask-reply", 18, 0},
+}
+
+// icmpv6TypeCodes is the ICMPv6 name table used by the ipset utility.
+var icmpv6TypeCodes = []icmpName{
+	{"no-route", 1, 0},
+	{"communication-prohibited", 1, 1},
+	{"address-unreachable", 1, 3},
+	{"port-unreachable", 1, 4},
+	{"packet-too-big", 2, 0},
+	{"ttl-zero-during-transit", 3, 0},
+	{"ttl-zero-during-reassembly", 3, 1},
+	{"bad-header", 4, 0},
+	{"unknown-header-type", 4, 1},
+	{"unknown-option", 4, 2},
+	{"echo-request", 128, 0},
+	{"ping", 128, 0},
+	{"echo-reply", 129, 0},
+	{"pong", 129, 0},
+	{"router-solicitation", 133, 0},
+	{"router-advertisement", 134, 0},
+	{"neighbour-solicitation", 135, 0},
+	{"neighbour-advertisement", 136, 0},
+	{"redirect", 137, 0},
+}
+
+// ICMPTypeCode packs an ICMP or ICMPv6 type/code pair into the port value
+// the kernel stores for hash:*,port types.
+func ICMPTypeCode(typ, code uint8) uint16 {
+	return uint16(typ)<<8 | uint16(code)
+}
+
+// ParseICMPType parses an ICMP type given by name (e.g. "echo-request") or as
+// numeric "type/code".
+func ParseICMPType(s string) (typ uint8, code uint8, err error) {
+	return parseICMPName(icmpTypeCodes, "icmp", s)
+}
+
+// ParseICMPv6Type parses an ICMPv6 type given by name (e.g. "echo-request")
+// or as numeric "type/code".
+func ParseICMPv6Type(s string) (typ uint8, code uint8, err error) {
+	return parseICMPName(icmpv6TypeCodes, "icmpv6", s)
+}
+
+// ICMPTypeName returns the name of an ICMP type/code pair, or "type/code" if
+// the pair has no name.
+func ICMPTypeName(typ, code uint8) string {
+	return icmpNameOf(icmpTypeCodes, typ, code)
+}
+
+// ICMPv6TypeName returns the name of an ICMPv6 type/code pair, or "type/code"
+// if the pair has no name.
+func ICMPv6TypeName(typ, code uint8) string {
+	return icmpNameOf(icmpv6TypeCodes, typ, code)
+}
+
+func parseICMPName(table []icmpName, proto, s string) (uint8, uint8, error) {
+	for _, n := range table {
+		if strings.EqualFold(n.name, s) {
+			return n.typ, n.code, nil
+		}
+	}
+
+	idx := strings.IndexByte(s, '/')
+	if idx > 0 {
+		typ, err := strconv.ParseUint(s[:idx], 10, 8)
+		if err == nil {
+			var code uint64
+			code, err = strconv.ParseUint(s[idx+1:], 10, 8)
+			if err == nil {
+				return uint8(typ), uint8(code), nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid %s type/code: %q", proto, s)
+}
+
+func icmpNameOf(table []icmpName, typ, code uint8) string {
+	for _, n := range table {
+		if n.typ == typ && n.code == code {
+			return n.name
+		}
+	}
+	return strconv.Itoa(int(typ)) + "/" + strconv.Itoa(int(code))
+}
+
+// SetICMP makes the entry match the given ICMP type/code instead of a port.
+func (e *Entry) SetICMP(typ, code uint8) {
+	proto := uint8(ProtocolICMP)
+	port := ICMPTypeCode(typ, code)
+	e.Protocol = &proto
+	e.Port = &port
+}
+
+// SetICMPv6 makes the entry match the given ICMPv6 type/code instead of a port.
+func (e *Entry) SetICMPv6(typ, code uint8) {
+	proto := uint8(ProtocolICMPv6)
+	port := ICMPTypeCode(typ, code)
+	e.Protocol = &proto
+	e.Port = &port
+}
+
+// ICMP returns the ICMP or ICMPv6 type/code pair carried in the port field.
+// ok is false if the entry protocol is neither ICMP nor ICMPv6.
+func (e *Entry) ICMP() (typ uint8, code uint8, ok bool) {
+	if e.Protocol == nil || e.Port == nil {
+		return 0, 0, false
+	}
+	switch uint16(*e.Protocol) {
+	case ProtocolICMP, ProtocolICMPv6:
+		return uint8(*e.Port >> 8), uint8(*e.Port), true
+	}
+	return 0, 0, false
+}
+
+// PortString returns the protocol and port of the entry the way the ipset
+// utility prints them, e.g. "tcp:80", "udp:53" or "icmp:echo-request".
+func (e *Entry) PortString() string {
+	if e.Port == nil {
+		return ""
+	}
+
+	proto := uint8(ProtocolTCP)
+	if e.Protocol != nil {
+		proto = *e.Protocol
+	}
+
+	switch uint16(proto) {
+	case ProtocolICMP:
+		return "icmp:" + ICMPTypeName(uint8(*e.Port>>8), uint8(*e.Port))
+	case ProtocolICMPv6:
+		return "icmpv6:" + ICMPv6TypeName(uint8(*e.Port>>8), uint8(*e.Port))
+	}
+	return ProtocolName(proto) + ":" + strconv.Itoa(int(*e.Port))
+}
+
+// ProtocolName returns the name ipset uses for an IP protocol number, or the
+// number itself if it is not known.
+func ProtocolName(proto uint8) string {
+	switch uint16(proto) {
+	case ProtocolTCP:
+		return "tcp"
+	case ProtocolUDP:
+		return "udp"
+	case ProtocolSCTP:
+		return "sctp"
+	case ProtocolUDPLite:
+		return "udplite"
+	case ProtocolICMP:
+		return "icmp"
+	case ProtocolICMPv6:
+		return "icmpv6"
+	}
+	return strconv.Itoa(int(proto))
+}
+
+// ParseProtocol parses a protocol name as returned by ProtocolName.
+func ParseProtocol(s string) (uint8, error) {
+	switch strings.ToLower(s) {
+	case "tcp":
+		return uint8(ProtocolTCP), nil
+	case "udp":
+		return uint8(ProtocolUDP), nil
+	case "sctp":
+		return uint8(ProtocolSCTP), nil
+	case "udplite":
+		return uint8(ProtocolUDPLite), nil
+	case "icmp":
+		return uint8(ProtocolICMP), nil
+	case "icmpv6", "ipv6-icmp":
+		return uint8(ProtocolICMPv6), nil
+	}
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid protocol: %q", s)
+	}
+	return uint8(v), nil
+}
+
+// ParsePort parses a "[proto:]port" string as accepted by the ipset utility
+// for hash:*,port types, e.g. "80", "udp:53-60", "icmp:echo-request" or
+// "icmpv6:1/0", and stores the result in the entry.
+func (e *Entry) ParsePort(s string) error {
+	proto := "tcp"
+	if idx := strings.IndexByte(s, ':'); idx >= 0 {
+		proto, s = s[:idx], s[idx+1:]
+	}
+
+	p, err := ParseProtocol(proto)
+	if err != nil {
+		return err
+	}
+
+	switch uint16(p) {
+	case ProtocolICMP:
+		typ, code, err := ParseICMPType(s)
+		if err != nil {
+			return err
+		}
+		e.SetICMP(typ, code)
+		return nil
+	case ProtocolICMPv6:
+		typ, code, err := ParseICMPv6Type(s)
+		if err != nil {
+			return err
+		}
+		e.SetICMPv6(typ, code)
+		return nil
+	}
+
+	var portTo *uint16
+	if idx := strings.IndexByte(s, '-'); idx >= 0 {
+		to, err := strconv.ParseUint(s[idx+1:], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port: %q", s[idx+1:])
+		}
+		portTo = Uint16Ptr(uint16(to))
+		s = s[:idx]
+	}
+
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port: %q", s)
+	}
+	e.Protocol = &p
+	e.Port = Uint16Ptr(uint16(port))
+	e.PortTo = portTo
+	return nil
+}
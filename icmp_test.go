@@ -0,0 +1,84 @@
+package ipset
+
+import (
+	"testing"
+)
+
+func TestParseICMPType(t *testing.T) {
+	testCases := []struct {
+		input string
+		v6    bool
+		typ   uint8
+		code  uint8
+		name  string
+	}{
+		{input: "echo-request", typ: 8, code: 0, name: "echo-request"},
+		{input: "ping", typ: 8, code: 0, name: "echo-request"},
+		{input: "host-unreachable", typ: 3, code: 1, name: "host-unreachable"},
+		{input: "3/8", typ: 3, code: 8, name: "3/8"},
+		{input: "echo-request", v6: true, typ: 128, code: 0, name: "echo-request"},
+		{input: "packet-too-big", v6: true, typ: 2, code: 0, name: "packet-too-big"},
+		{input: "1/2", v6: true, typ: 1, code: 2, name: "1/2"},
+	}
+
+	for _, tC := range testCases {
+		parse, name := ParseICMPType, ICMPTypeName
+		if tC.v6 {
+			parse, name = ParseICMPv6Type, ICMPv6TypeName
+		}
+
+		typ, code, err := parse(tC.input)
+		if err != nil {
+			t.Fatalf("%s: %v", tC.input, err)
+		}
+		if typ != tC.typ || code != tC.code {
+			t.Errorf("%s: expected %d/%d, got %d/%d", tC.input, tC.typ, tC.code, typ, code)
+		}
+		if n := name(typ, code); n != tC.name {
+			t.Errorf("%s: expected name %q, got %q", tC.input, tC.name, n)
+		}
+	}
+
+	for _, input := range []string{"bogus", "256/0", "8/", "/0"} {
+		if _, _, err := ParseICMPType(input); err == nil {
+			t.Errorf("expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestEntryParsePort(t *testing.T) {
+	testCases := []struct {
+		input    string
+		protocol uint8
+		port     uint16
+		output   string
+	}{
+		{input: "80", protocol: uint8(ProtocolTCP), port: 80, output: "tcp:80"},
+		{input: "udp:53", protocol: uint8(ProtocolUDP), port: 53, output: "udp:53"},
+		{input: "icmp:ping", protocol: uint8(ProtocolICMP), port: 0x0800, output: "icmp:echo-request"},
+		{input: "icmpv6:1/0", protocol: uint8(ProtocolICMPv6), port: 0x0100, output: "icmpv6:no-route"},
+	}
+
+	for _, tC := range testCases {
+		var entry Entry
+		if err := entry.ParsePort(tC.input); err != nil {
+			t.Fatalf("%s: %v", tC.input, err)
+		}
+		if *entry.Protocol != tC.protocol || *entry.Port != tC.port {
+			t.Errorf("%s: expected %d:%#04x, got %d:%#04x", tC.input, tC.protocol, tC.port, *entry.Protocol, *entry.Port)
+		}
+		if s := entry.PortString(); s != tC.output {
+			t.Errorf("%s: expected %q, got %q", tC.input, tC.output, s)
+		}
+	}
+
+	var entry Entry
+	entry.SetICMP(3, 3)
+	if typ, code, ok := entry.ICMP(); !ok || typ != 3 || code != 3 {
+		t.Errorf("expected icmp 3/3, got %d/%d (%v)", typ, code, ok)
+	}
+	entry.Protocol = Uint8Ptr(uint8(ProtocolTCP))
+	if _, _, ok := entry.ICMP(); ok {
+		t.Error("expected tcp entry not to report an icmp type")
+	}
+}
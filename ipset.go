@@ -2,6 +2,7 @@
 
 import (
 	"strings"
+	"time"
 )
 
 const (
@@ -45,7 +46,8 @@ func Create(setname, typename string, options CreateOptions) error {
 	return pkgHandle.Create(setname, typename, options)
 }
 
-// Destroy destroys an existing ipset. Equivalent to: `ipset destroy hash01`
+// Destroy destroys an existing ipset. Equivalent to: `ipset destroy hash01`.
+// An empty setname destroys all sets.
 func Destroy(setname string) error {
 	return pkgHandle.Destroy(setname)
 }
@@ -55,7 +57,7 @@ func ForceDestroy(setname string) error {
 	return pkgHandle.ForceDestroy(setname)
 }
 
-// Flush flushes an existing ipset
+// Flush flushes an existing ipset. An empty setname flushes all sets.
 func Flush(setname string) error {
 	return pkgHandle.Flush(setname)
 }
@@ -65,6 +67,11 @@ func List(setname string) (*Sets, error) {
 	return pkgHandle.List(setname)
 }
 
+// Header returns the name, type, revision and family of an existing ipset.
+func Header(setname string) (*Sets, error) {
+	return pkgHandle.Header(setname)
+}
+
 // ListAll dumps all ipsets.
 func ListAll() ([]Sets, error) {
 	return pkgHandle.ListAll()
@@ -80,6 +87,39 @@ func Del(setname string, entry *Entry) error {
 	return pkgHandle.Del(setname, entry)
 }
 
+// AddBatch adds entries to an existing ipset in as few netlink messages as
+// their size allows, updating those already in the set.
+func AddBatch(setname string, entries []*Entry) error {
+	return pkgHandle.AddBatch(setname, entries)
+}
+
+// DelBatch deletes entries from an existing ipset in as few netlink messages
+// as their size allows, ignoring those not in the set.
+func DelBatch(setname string, entries []*Entry) error {
+	return pkgHandle.DelBatch(setname, entries)
+}
+
+// Test tests whether an entry is in an existing ipset.
+func Test(setname string, entry *Entry) (bool, error) {
+	return pkgHandle.Test(setname, entry)
+}
+
+// GetByName returns the kernel index and the family of a set.
+func GetByName(setname string) (index uint16, family uint8, err error) {
+	return pkgHandle.GetByName(setname)
+}
+
+// GetByIndex returns the name of the set with the kernel index.
+func GetByIndex(index uint16) (string, error) {
+	return pkgHandle.GetByIndex(index)
+}
+
+// Touch refreshes the timeout of an existing entry to ttl, preserving its
+// counters, comment and skbinfo.
+func Touch(setname string, entry *Entry, ttl time.Duration) error {
+	return pkgHandle.Touch(setname, entry, ttl)
+}
+
 // Rename rename a set. Set identified by SETNAME-TO must not exist.
 func Rename(from string, to string) error {
 	return pkgHandle.Rename(from, to)
@@ -90,6 +130,65 @@ func Swap(from string, to string) error {
 	return pkgHandle.Swap(from, to)
 }
 
+// Clone creates the set dst with the header of src and, if withEntries,
+// its entries.
+func Clone(src, dst string, withEntries bool) error {
+	return pkgHandle.Clone(src, dst, withEntries)
+}
+
+// WriteSet adds the entries of set to the set setname, creating it with the
+// header of set if it does not exist.
+func WriteSet(setname string, set *Sets) error {
+	return pkgHandle.WriteSet(setname, set)
+}
+
+// SetGrowPolicy sets the policy of growing full hash sets of the package
+// functions.
+func SetGrowPolicy(p *GrowPolicy) {
+	pkgHandle.SetGrowPolicy(p)
+}
+
+// Grow recreates the hash set setname with maxelem, copying its entries,
+// and swaps it in.
+func Grow(setname string, maxelem uint32) error {
+	return pkgHandle.Grow(setname, maxelem)
+}
+
+// SetTrace makes the package functions call trace with every message they
+// send and receive. A nil trace disables tracing.
+func SetTrace(trace func(TraceMessage)) {
+	pkgHandle.SetTrace(trace)
+}
+
+// CreateDualStack creates the sets name-v4 and name-v6 of family inet and
+// inet6.
+func CreateDualStack(name, typename string, options CreateOptions) error {
+	return pkgHandle.CreateDualStack(name, typename, options)
+}
+
+// DestroyDualStack destroys both halves of the dual-stack set name.
+func DestroyDualStack(name string) error {
+	return pkgHandle.DestroyDualStack(name)
+}
+
+// AddDualStack adds entry to the half of the dual-stack set name matching
+// its family.
+func AddDualStack(name string, entry *Entry) error {
+	return pkgHandle.AddDualStack(name, entry)
+}
+
+// DelDualStack deletes entry from the half of the dual-stack set name
+// matching its family.
+func DelDualStack(name string, entry *Entry) error {
+	return pkgHandle.DelDualStack(name, entry)
+}
+
+// TestDualStack tests whether entry is in the half of the dual-stack set name
+// matching its family.
+func TestDualStack(name string, entry *Entry) (bool, error) {
+	return pkgHandle.TestDualStack(name, entry)
+}
+
 var typeRevisionsMap = map[string][]uint8{
 	TypeListSet: {3, 2, 1, 0},
 
@@ -7,7 +7,7 @@
 	"os"
 )
 
-func ExampleCreateAdd() {
+func Example_createAdd() {
 	var setname = "hash01"
 	err := Create(setname, TypeHashIP, CreateOptions{})
 	if err != nil {
@@ -1,10 +1,13 @@
 package ipset
 
 import (
+	"fmt"
 	"log"
 	"net"
 	"os"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/vishvananda/netlink/nl"
 	"golang.org/x/sys/unix"
@@ -16,16 +19,25 @@ type Entry struct {
 	Comment  string
 	MAC      net.HardwareAddr
 	IP       net.IP
+	IPTo     net.IP // end of an IP range, for types that accept ranges
 	CIDR     uint8
 	Timeout  *uint32
+	TTL      *time.Duration // timeout as a duration, takes precedence over Timeout
 	Packets  *uint64
 	Bytes    *uint64
 	Protocol *uint8
 	Port     *uint16
+	PortTo   *uint16 // end of a port range
 	IP2      net.IP
 	CIDR2    uint8
 	IFace    string
 	Mark     *uint32
+	NoMatch  bool
+
+	SkbMark  *uint32
+	SkbMask  *uint32
+	SkbPrio  *uint32
+	SkbQueue *uint16
 
 	Replace bool // replace existing entry
 }
@@ -38,10 +50,13 @@ type Sets struct {
 	Revision           uint8
 	Family             uint8
 	Flags              uint8
+	Index              uint16 // kernel index, returned by GetByName
 	SetName            string
 	TypeName           string
 	Comment            string
 	MarkMask           uint32
+	NetMask            uint8
+	BitMask            net.IP
 
 	IPFrom   net.IP
 	IPTo     net.IP
@@ -50,19 +65,24 @@ type Sets struct {
 
 	Size         uint32
 	HashSize     uint32
+	BucketSize   uint8
+	InitVal      uint32
 	NumEntries   uint32
 	MaxElements  uint32
 	References   uint32
 	SizeInMemory uint32
 	CadtFlags    uint32
 	Timeout      *uint32
+	TTL          *time.Duration // default timeout as a duration
 	LineNo       uint32
 
 	Entries []Entry
 }
 
+// Protocol returns the protocol version of the kernel and the oldest version
+// it accepts.
 func (h *Handle) Protocol() (protocol uint8, minVersion uint8, err error) {
-	req := h.newRequest(IPSET_CMD_PROTOCOL)
+	req := h.newRequestProtocol(IPSET_CMD_PROTOCOL, IPSET_PROTOCOL_MIN, FamilyUnspec)
 	msgs, err := req.Execute(unix.NETLINK_NETFILTER, 0)
 
 	if err != nil {
@@ -72,8 +92,101 @@ func (h *Handle) Protocol() (protocol uint8, minVersion uint8, err error) {
 	return response.Protocol, response.ProtocolMinVersion, nil
 }
 
+// ProtocolVersion returns the protocol version the handle speaks with the
+// kernel: the newest version both support. It is negotiated on first use; if
+// that fails, requests fall back to IPSET_PROTOCOL from then on.
+func (h *Handle) ProtocolVersion() (uint8, error) {
+	if v := atomic.LoadUint32(&h.protocol); v != 0 {
+		return uint8(v), nil
+	}
+
+	protocol, minVersion, err := h.Protocol()
+	if err != nil {
+		return 0, err
+	}
+	if protocol > IPSET_PROTOCOL_MAX {
+		protocol = IPSET_PROTOCOL_MAX
+	}
+	if protocol < IPSET_PROTOCOL_MIN || minVersion > IPSET_PROTOCOL_MAX {
+		return 0, fmt.Errorf("ipset: kernel protocol %d (min %d) is not supported", protocol, minVersion)
+	}
+	atomic.StoreUint32(&h.protocol, uint32(protocol))
+	return protocol, nil
+}
+
+// GetByName returns the kernel index of a set, as referenced by iptables
+// rules, and its family. It requires protocol 7.
+func (h *Handle) GetByName(setname string) (index uint16, family uint8, err error) {
+	if err := h.requireProtocol(7); err != nil {
+		return 0, 0, err
+	}
+	req := h.newRequest(IPSET_CMD_GET_BYNAME)
+	req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(setname)))
+
+	msgs, err := h.execute(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	result := ipsetUnserialize(msgs)
+	return result.Index, result.Family, nil
+}
+
+// GetByIndex returns the name of the set with the kernel index. It requires
+// protocol 7.
+func (h *Handle) GetByIndex(index uint16) (setname string, err error) {
+	if err := h.requireProtocol(7); err != nil {
+		return "", err
+	}
+	req := h.newRequest(IPSET_CMD_GET_BYINDEX)
+	req.AddData(nl.NewRtAttr(IPSET_ATTR_INDEX|int(nl.NLA_F_NET_BYTEORDER), htons(index)))
+
+	msgs, err := h.execute(req)
+	if err != nil {
+		return "", err
+	}
+	return ipsetUnserialize(msgs).SetName, nil
+}
+
+func (h *Handle) requireProtocol(version uint8) error {
+	protocol, err := h.ProtocolVersion()
+	if err != nil {
+		return err
+	}
+	if protocol < version {
+		return fmt.Errorf("ipset: kernel protocol %d, %d required", protocol, version)
+	}
+	return nil
+}
+
 func (h *Handle) Create(setname, typename string, options CreateOptions) error {
-	req := h.newRequest(IPSET_CMD_CREATE)
+	req, err := h.createRequest(setname, typename, options)
+	if err != nil {
+		return err
+	}
+	_, err = h.execute(req)
+	return err
+}
+
+// createRequest returns the request creating the set, after filling in the
+// defaults of options.
+func (h *Handle) createRequest(setname, typename string, options CreateOptions) (*nl.NetlinkRequest, error) {
+	requested := options.Revision
+	options.fillWithDefault(typename)
+	if err := options.fillMasks(typename, requested); err != nil {
+		return nil, err
+	}
+
+	if TypeName(typename).Method() == "bitmap" {
+		if err := options.validateBitmap(typename); err != nil {
+			return nil, err
+		}
+	}
+
+	family := options.Family
+	if family == 0xff {
+		family = FamilyUnspec
+	}
+	req := h.newRequestFamily(IPSET_CMD_CREATE, family)
 
 	if !options.Replace {
 		req.Flags |= unix.NLM_F_EXCL
@@ -82,8 +195,6 @@ func (h *Handle) Create(setname, typename string, options CreateOptions) error {
 	req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(setname)))
 	req.AddData(nl.NewRtAttr(IPSET_ATTR_TYPENAME, nl.ZeroTerminated(typename)))
 
-	options.fillWithDefault(typename)
-
 	req.AddData(nl.NewRtAttr(IPSET_ATTR_REVISION, nl.Uint8Attr(options.Revision)))
 
 	data := nl.NewRtAttr(IPSET_ATTR_DATA|int(nl.NLA_F_NESTED), nil)
@@ -101,6 +212,10 @@ func (h *Handle) Create(setname, typename string, options CreateOptions) error {
 		}
 	}
 
+	if options.MaxElements > 0 && TypeName(typename).Method() == "hash" {
+		data.AddChild(&nl.Uint32Attribute{Type: IPSET_ATTR_MAXELEM | nl.NLA_F_NET_BYTEORDER, Value: options.MaxElements})
+	}
+
 	switch typename {
 	case TypeBitmapPort:
 		data.AddChild(nl.NewRtAttr(IPSET_ATTR_PORT_FROM|int(nl.NLA_F_NET_BYTEORDER), htons(options.PortFrom)))
@@ -115,7 +230,19 @@ func (h *Handle) Create(setname, typename string, options CreateOptions) error {
 		data.AddChild(ipTo)
 	}
 
-	if timeout := options.Timeout; timeout > 0 {
+	if options.NetMask > 0 {
+		data.AddChild(nl.NewRtAttr(IPSET_ATTR_NETMASK, nl.Uint8Attr(uint8(options.NetMask))))
+	}
+
+	if options.BitMask != nil {
+		data.AddChild(newIPAttr(IPSET_ATTR_BITMASK, int(options.Family), options.BitMask))
+	}
+
+	if options.MarkMask > 0 && typename == TypeHashIPMark {
+		data.AddChild(&nl.Uint32Attribute{Type: IPSET_ATTR_MARKMASK | nl.NLA_F_NET_BYTEORDER, Value: options.MarkMask})
+	}
+
+	if timeout := options.timeout(); timeout > 0 {
 		data.AddChild(&nl.Uint32Attribute{Type: IPSET_ATTR_TIMEOUT | nl.NLA_F_NET_BYTEORDER, Value: timeout})
 	}
 
@@ -124,29 +251,40 @@ func (h *Handle) Create(setname, typename string, options CreateOptions) error {
 	}
 
 	req.AddData(data)
-	_, err := ipsetExecute(req)
-	return err
+	return req, nil
 }
 
+// Destroy destroys an existing ipset. An empty setname destroys all sets.
 func (h *Handle) Destroy(setname string) error {
 	req := h.newRequest(IPSET_CMD_DESTROY)
-	req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(setname)))
-	_, err := ipsetExecute(req)
+	if setname != "" {
+		req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(setname)))
+	}
+	_, err := h.execute(req)
 	return err
 }
 
 func (h *Handle) ForceDestroy(setname string) error {
 	err := h.Destroy(setname)
-	if err != nil && err != ErrSetNotExist && !os.IsNotExist(err) {
+	if err != nil && !isNotExist(err) {
 		return err
 	}
 	return nil
 }
 
+// isNotExist reports whether err reports a set which does not exist. The
+// kernel returns a plain ENOENT.
+func isNotExist(err error) bool {
+	return err == ErrSetNotExist || os.IsNotExist(err)
+}
+
+// Flush flushes an existing ipset. An empty setname flushes all sets.
 func (h *Handle) Flush(setname string) error {
 	req := h.newRequest(IPSET_CMD_FLUSH)
-	req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(setname)))
-	_, err := ipsetExecute(req)
+	if setname != "" {
+		req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(setname)))
+	}
+	_, err := h.execute(req)
 	return err
 }
 
@@ -154,7 +292,21 @@ func (h *Handle) List(name string) (*Sets, error) {
 	req := h.newRequest(IPSET_CMD_LIST)
 	req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(name)))
 
-	msgs, err := ipsetExecute(req)
+	msgs, err := h.execute(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ipsetUnserialize(msgs)
+	return &result, nil
+}
+
+// Header returns the name, type, revision and family of an existing ipset.
+func (h *Handle) Header(name string) (*Sets, error) {
+	req := h.newRequest(IPSET_CMD_HEADER)
+	req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(name)))
+
+	msgs, err := h.execute(req)
 	if err != nil {
 		return nil, err
 	}
@@ -166,7 +318,7 @@ func (h *Handle) List(name string) (*Sets, error) {
 func (h *Handle) ListAll() ([]Sets, error) {
 	req := h.newRequest(IPSET_CMD_LIST)
 
-	msgs, err := ipsetExecute(req)
+	msgs, err := h.execute(req)
 	if err != nil {
 		return nil, err
 	}
@@ -181,7 +333,11 @@ func (h *Handle) ListAll() ([]Sets, error) {
 
 // Add adds an entry to an existing ipset.
 func (h *Handle) Add(setname string, entry *Entry) error {
-	return h.addDel(IPSET_CMD_ADD, setname, entry)
+	err := h.addDel(IPSET_CMD_ADD, setname, entry)
+	if h.growOnFull(setname, err) {
+		err = h.addDel(IPSET_CMD_ADD, setname, entry)
+	}
+	return err
 }
 
 // Del deletes an entry from an existing ipset.
@@ -189,6 +345,49 @@ func (h *Handle) Del(setname string, entry *Entry) error {
 	return h.addDel(IPSET_CMD_DEL, setname, entry)
 }
 
+// Test tests whether an entry is in an existing ipset.
+func (h *Handle) Test(setname string, entry *Entry) (bool, error) {
+	err := h.addDel(IPSET_CMD_TEST, setname, entry)
+	if err == ErrEntryNotExist {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Touch refreshes the timeout of an existing entry to ttl. The entry is
+// re-added in place, keeping its counters, and its comment and skbinfo unless
+// entry sets them. An entry that expires between the lookup and the refresh
+// is added again.
+func (h *Handle) Touch(setname string, entry *Entry, ttl time.Duration) error {
+	set, err := h.List(setname)
+	if err != nil {
+		return err
+	}
+	live := set.Find(entry)
+	if live == nil {
+		return ErrEntryNotExist
+	}
+
+	// the kernel resets the comment and skbinfo to those sent
+	refreshed := *entry
+	refreshed.Packets, refreshed.Bytes = nil, nil
+	if refreshed.Comment == "" {
+		refreshed.Comment = live.Comment
+	}
+	if refreshed.SkbMark == nil {
+		refreshed.SkbMark, refreshed.SkbMask = live.SkbMark, live.SkbMask
+	}
+	if refreshed.SkbPrio == nil {
+		refreshed.SkbPrio = live.SkbPrio
+	}
+	if refreshed.SkbQueue == nil {
+		refreshed.SkbQueue = live.SkbQueue
+	}
+	refreshed.SetTTL(ttl)
+	refreshed.Replace = true
+	return h.addDel(IPSET_CMD_ADD, setname, &refreshed)
+}
+
 // Rename rename a set. Set identified by SETNAME-TO must not exist.
 func (h *Handle) Rename(from string, to string) error {
 	return h.renameSwap(IPSET_CMD_RENAME, from, to)
@@ -200,10 +399,34 @@ func (h *Handle) Swap(from string, to string) error {
 }
 
 func (h *Handle) addDel(nlCmd int, setname string, entry *Entry) error {
-	req := h.newRequest(nlCmd)
-	req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(setname)))
+	req, err := h.addDelRequest(nlCmd, setname, entry)
+	if err != nil {
+		return err
+	}
 
-	data := nl.NewRtAttr(IPSET_ATTR_DATA|int(nl.NLA_F_NESTED), nil)
+	_, err = h.execute(req)
+	if entry.IPTo != nil && nlCmd != IPSET_CMD_TEST && h.rangeUnsupported(setname, err) {
+		// the type or the family does not accept ranges, send the networks
+		if xerr := h.addDelExpanded(nlCmd, setname, entry); xerr != nil {
+			return fmt.Errorf("%w (expanding the range: %v)", err, xerr)
+		}
+		return nil
+	}
+	if err == IPSetError(IPSET_ERR_BITMAP_RANGE) {
+		// the code is shared with other types, only list bitmap sets
+		if set, lerr := h.Header(setname); lerr == nil && TypeName(set.TypeName).Method() == "bitmap" {
+			if set, lerr = h.List(setname); lerr == nil {
+				err = bitmapRangeError(set, entry, err)
+			}
+		}
+	}
+	return err
+}
+
+// addDelRequest returns the request adding, deleting or testing entry.
+func (h *Handle) addDelRequest(nlCmd int, setname string, entry *Entry) (*nl.NetlinkRequest, error) {
+	req := h.newRequestFamily(nlCmd, entry.Family())
+	req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(setname)))
 
 	if entry.Replace {
 		req.Flags |= unix.NLM_F_REPLACE
@@ -211,6 +434,132 @@ func (h *Handle) addDel(nlCmd int, setname string, entry *Entry) error {
 		req.Flags |= unix.NLM_F_EXCL
 	}
 
+	data, err := entryData(entry, 0)
+	if err != nil {
+		return nil, err
+	}
+	req.AddData(data)
+	return req, nil
+}
+
+// noRangeTypes are the types whose entries have no IP_TO attribute, which
+// the kernel refuses as a protocol error.
+var noRangeTypes = map[string]bool{
+	TypeBitmapIPMac: true,
+	TypeHashIPMac:   true,
+}
+
+// rangeUnsupported reports whether err refuses the range of an entry of
+// setname, rather than a malformed request.
+func (h *Handle) rangeUnsupported(setname string, err error) bool {
+	switch err {
+	case IPSetError(IPSET_ERR_HASH_RANGE_UNSUPPORTED):
+		return true
+	case ErrInvalidProtocol:
+		set, herr := h.Header(setname)
+		return herr == nil && noRangeTypes[set.TypeName]
+	}
+	return false
+}
+
+// addDelExpanded adds or deletes the range of entry as the networks or
+// addresses covering it.
+func (h *Handle) addDelExpanded(nlCmd int, setname string, entry *Entry) error {
+	set, err := h.Header(setname)
+	if err != nil {
+		return err
+	}
+	entries, err := ExpandRange(set.TypeName, entry)
+	if err != nil {
+		return err
+	}
+	return h.addDelBatch(nlCmd, setname, entries)
+}
+
+// AddBatch adds entries to an existing ipset in as few netlink messages as
+// their size allows. Unlike Add, entries already in the set are updated
+// whatever their Replace field. The kernel stops at the first entry it fails
+// to add.
+func (h *Handle) AddBatch(setname string, entries []*Entry) error {
+	err := h.addDelBatch(IPSET_CMD_ADD, setname, entries)
+	if h.growOnFull(setname, err) {
+		err = h.addDelBatch(IPSET_CMD_ADD, setname, entries)
+	}
+	return err
+}
+
+// DelBatch deletes entries from an existing ipset in as few netlink messages
+// as their size allows. Entries not in the set are ignored.
+func (h *Handle) DelBatch(setname string, entries []*Entry) error {
+	return h.addDelBatch(IPSET_CMD_DEL, setname, entries)
+}
+
+// maxADTPayload is the largest payload of an IPSET_ATTR_ADT attribute, whose
+// length is a uint16 including the attribute header.
+const maxADTPayload = (0xffff - unix.SizeofRtAttr) &^ 3
+
+func (h *Handle) addDelBatch(nlCmd int, setname string, entries []*Entry) error {
+	batches, err := splitBatch(entries)
+	if err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		req := h.newRequestFamily(nlCmd, batch[0].Family())
+		req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(setname)))
+		// without NLM_F_EXCL, existing entries are updated and missing ones
+		// are not deleted, whatever Entry.Replace
+		req.Flags |= unix.NLM_F_REPLACE
+
+		adt := nl.NewRtAttr(IPSET_ATTR_ADT|int(nl.NLA_F_NESTED), nil)
+		for i, entry := range batch {
+			data, err := entryData(entry, uint32(i+1))
+			if err != nil {
+				return err
+			}
+			adt.AddChild(data)
+		}
+		req.AddData(adt)
+		// the kernel requires a line number along with multiple data containers
+		req.AddData(&nl.Uint32Attribute{Type: IPSET_ATTR_LINENO | nl.NLA_F_NET_BYTEORDER, Value: 0})
+
+		if _, err := h.execute(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitBatch splits entries into batches whose data attributes fit in the
+// length of a single ADT attribute.
+func splitBatch(entries []*Entry) ([][]*Entry, error) {
+	var batches [][]*Entry
+	start, size := 0, 0
+	for i, entry := range entries {
+		data, err := entryData(entry, uint32(i-start+1))
+		if err != nil {
+			return nil, err
+		}
+		n := (data.Len() + 3) &^ 3
+		if n > maxADTPayload {
+			return nil, fmt.Errorf("ipset: entry %d is too large for a netlink attribute", i+1)
+		}
+		if size+n > maxADTPayload {
+			batches = append(batches, entries[start:i])
+			start, size = i, 0
+		}
+		size += n
+	}
+	if start < len(entries) {
+		batches = append(batches, entries[start:])
+	}
+	return batches, nil
+}
+
+// entryData returns the data attribute of an entry. lineno identifies the
+// entry in batched requests.
+func entryData(entry *Entry, lineno uint32) (*nl.RtAttr, error) {
+	data := nl.NewRtAttr(IPSET_ATTR_DATA|int(nl.NLA_F_NESTED), nil)
+
 	if entry.Name != "" {
 		data.AddChild(nl.NewRtAttr(IPSET_ATTR_NAME, nl.ZeroTerminated(entry.Name)))
 	}
@@ -219,18 +568,14 @@ func (h *Handle) addDel(nlCmd int, setname string, entry *Entry) error {
 		data.AddChild(nl.NewRtAttr(IPSET_ATTR_COMMENT, nl.ZeroTerminated(entry.Comment)))
 	}
 
-	if entry.Timeout != nil {
-		data.AddChild(&nl.Uint32Attribute{Type: IPSET_ATTR_TIMEOUT | nl.NLA_F_NET_BYTEORDER, Value: *entry.Timeout})
+	if timeout := entry.timeout(); timeout != nil {
+		data.AddChild(&nl.Uint32Attribute{Type: IPSET_ATTR_TIMEOUT | nl.NLA_F_NET_BYTEORDER, Value: *timeout})
 	}
 
 	family := nl.GetIPFamily(entry.IP)
 
 	if ip := entry.IP; ip != nil {
-		if family == nl.FAMILY_V4 {
-			ip = ip.To4()
-		}
-		nestedData := nl.NewRtAttr(IPSET_ATTR_IP|int(nl.NLA_F_NET_BYTEORDER), ip)
-		data.AddChild(nl.NewRtAttr(IPSET_ATTR_IP|int(nl.NLA_F_NESTED), nestedData.Serialize()))
+		data.AddChild(newIPAttr(IPSET_ATTR_IP, family, ip))
 	}
 
 	if entry.MAC != nil {
@@ -241,12 +586,12 @@ func (h *Handle) addDel(nlCmd int, setname string, entry *Entry) error {
 		data.AddChild(nl.NewRtAttr(IPSET_ATTR_CIDR, nl.Uint8Attr(entry.CIDR)))
 	}
 
+	if ip := entry.IPTo; ip != nil {
+		data.AddChild(newIPAttr(IPSET_ATTR_IP_TO, family, ip))
+	}
+
 	if ip := entry.IP2; ip != nil {
-		if family == nl.FAMILY_V4 {
-			ip = ip.To4()
-		}
-		nestedData := nl.NewRtAttr(IPSET_ATTR_IP|int(nl.NLA_F_NET_BYTEORDER), ip)
-		data.AddChild(nl.NewRtAttr(IPSET_ATTR_IP2|int(nl.NLA_F_NESTED), nestedData.Serialize()))
+		data.AddChild(newIPAttr(IPSET_ATTR_IP2, family, ip))
 	}
 
 	if entry.CIDR2 != 0 {
@@ -254,13 +599,30 @@ func (h *Handle) addDel(nlCmd int, setname string, entry *Entry) error {
 	}
 
 	if entry.Port != nil {
-		if entry.Protocol == nil {
-			// use tcp protocol as default
+		protocol := entry.Protocol
+		if protocol == nil && entry.IP != nil {
+			// use tcp protocol as default, bitmap:port entries have
+			// neither an address nor a protocol
 			val := uint8(ProtocolTCP)
-			entry.Protocol = &val
+			protocol = &val
+		}
+		if protocol != nil {
+			switch uint16(*protocol) {
+			case ProtocolICMP:
+				if family == nl.FAMILY_V6 {
+					return nil, fmt.Errorf("protocol icmp can be used with family inet only")
+				}
+			case ProtocolICMPv6:
+				if entry.IP != nil && family == nl.FAMILY_V4 {
+					return nil, fmt.Errorf("protocol icmpv6 can be used with family inet6 only")
+				}
+			}
+			data.AddChild(nl.NewRtAttr(IPSET_ATTR_PROTO, nl.Uint8Attr(*protocol)))
 		}
-		data.AddChild(nl.NewRtAttr(IPSET_ATTR_PROTO, nl.Uint8Attr(*entry.Protocol)))
 		data.AddChild(nl.NewRtAttr(int(IPSET_ATTR_PORT|nl.NLA_F_NET_BYTEORDER), htons(*entry.Port)))
+		if entry.PortTo != nil {
+			data.AddChild(nl.NewRtAttr(int(IPSET_ATTR_PORT_TO|nl.NLA_F_NET_BYTEORDER), htons(*entry.PortTo)))
+		}
 	}
 
 	if entry.IFace != "" {
@@ -271,11 +633,49 @@ func (h *Handle) addDel(nlCmd int, setname string, entry *Entry) error {
 		data.AddChild(&nl.Uint32Attribute{Type: IPSET_ATTR_MARK | nl.NLA_F_NET_BYTEORDER, Value: *entry.Mark})
 	}
 
-	data.AddChild(&nl.Uint32Attribute{Type: IPSET_ATTR_LINENO | nl.NLA_F_NET_BYTEORDER, Value: 0})
-	req.AddData(data)
+	if entry.Packets != nil {
+		data.AddChild(nl.NewRtAttr(IPSET_ATTR_PACKETS|int(nl.NLA_F_NET_BYTEORDER), htonll(*entry.Packets)))
+	}
 
-	_, err := ipsetExecute(req)
-	return err
+	if entry.Bytes != nil {
+		data.AddChild(nl.NewRtAttr(IPSET_ATTR_BYTES|int(nl.NLA_F_NET_BYTEORDER), htonll(*entry.Bytes)))
+	}
+
+	if entry.SkbMark != nil {
+		mask := uint32(0xffffffff)
+		if entry.SkbMask != nil {
+			mask = *entry.SkbMask
+		}
+		data.AddChild(nl.NewRtAttr(IPSET_ATTR_SKBMARK|int(nl.NLA_F_NET_BYTEORDER), htonll(uint64(*entry.SkbMark)<<32|uint64(mask))))
+	}
+
+	if entry.SkbPrio != nil {
+		data.AddChild(&nl.Uint32Attribute{Type: IPSET_ATTR_SKBPRIO | nl.NLA_F_NET_BYTEORDER, Value: *entry.SkbPrio})
+	}
+
+	if entry.SkbQueue != nil {
+		data.AddChild(nl.NewRtAttr(IPSET_ATTR_SKBQUEUE|int(nl.NLA_F_NET_BYTEORDER), htons(*entry.SkbQueue)))
+	}
+
+	if entry.NoMatch {
+		data.AddChild(&nl.Uint32Attribute{Type: IPSET_ATTR_CADT_FLAGS | nl.NLA_F_NET_BYTEORDER, Value: IPSET_FLAG_NOMATCH})
+	}
+
+	data.AddChild(&nl.Uint32Attribute{Type: IPSET_ATTR_LINENO | nl.NLA_F_NET_BYTEORDER, Value: lineno})
+	return data, nil
+}
+
+// newIPAttr returns a nested address attribute, using the IPv4 or IPv6
+// address type the kernel expects for the family.
+func newIPAttr(attrType int, family int, ip net.IP) *nl.RtAttr {
+	addrType := IPSET_ATTR_IPADDR_IPV4
+	if family == nl.FAMILY_V4 {
+		ip = ip.To4()
+	} else {
+		addrType = IPSET_ATTR_IPADDR_IPV6
+	}
+	nestedData := nl.NewRtAttr(addrType|int(nl.NLA_F_NET_BYTEORDER), ip)
+	return nl.NewRtAttr(attrType|int(nl.NLA_F_NESTED), nestedData.Serialize())
 }
 
 func (h *Handle) renameSwap(nlCmd int, from string, to string) error {
@@ -283,30 +683,72 @@ func (h *Handle) renameSwap(nlCmd int, from string, to string) error {
 	req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME, nl.ZeroTerminated(from)))
 	req.AddData(nl.NewRtAttr(IPSET_ATTR_SETNAME2, nl.ZeroTerminated(to)))
 
-	_, err := ipsetExecute(req)
+	_, err := h.execute(req)
 	return err
 }
 
+// newRequest returns a request of a command not bound to a family.
 func (h *Handle) newRequest(cmd int) *nl.NetlinkRequest {
+	return h.newRequestFamily(cmd, FamilyUnspec)
+}
+
+// newRequestFamily returns a request whose netfilter header carries family.
+func (h *Handle) newRequestFamily(cmd int, family uint8) *nl.NetlinkRequest {
+	protocol, err := h.ProtocolVersion()
+	if err != nil {
+		// let the kernel report the error of the actual command, and do not
+		// negotiate again for every request
+		protocol = IPSET_PROTOCOL
+		atomic.CompareAndSwapUint32(&h.protocol, 0, uint32(protocol))
+	}
+	return h.newRequestProtocol(cmd, protocol, family)
+}
+
+func (h *Handle) newRequestProtocol(cmd int, protocol uint8, family uint8) *nl.NetlinkRequest {
 	req := h.newNetlinkRequest(cmd|(unix.NFNL_SUBSYS_IPSET<<8), GetCommandFlags(cmd))
 
 	// Add the netfilter header
 	msg := &nl.Nfgenmsg{
-		NfgenFamily: uint8(unix.AF_INET),
+		NfgenFamily: family,
 		Version:     nl.NFNETLINK_V0,
 		ResId:       0,
 	}
 	req.AddData(msg)
-	req.AddData(nl.NewRtAttr(IPSET_ATTR_PROTOCOL, nl.Uint8Attr(IPSET_PROTOCOL)))
+	req.AddData(nl.NewRtAttr(IPSET_ATTR_PROTOCOL, nl.Uint8Attr(protocol)))
 
 	return req
 }
 
+// SetTrace makes the handle call trace with every message it sends and
+// receives. A nil trace disables tracing.
+func (h *Handle) SetTrace(trace func(TraceMessage)) {
+	h.trace.Store(trace)
+}
+
+// execute sends req, tracing it and its responses.
+func (h *Handle) execute(req *nl.NetlinkRequest) ([][]byte, error) {
+	trace, _ := h.trace.Load().(func(TraceMessage))
+	if trace == nil {
+		return ipsetExecute(req)
+	}
+
+	cmd := int(req.Type & 0xff)
+	trace(TraceMessage{Request: true, Cmd: cmd, Flags: req.Flags, Data: req.Serialize()[unix.SizeofNlMsghdr:]})
+	msgs, err := ipsetExecute(req)
+	for _, msg := range msgs {
+		trace(TraceMessage{Cmd: cmd, Data: msg})
+	}
+	if err != nil {
+		trace(TraceMessage{Cmd: cmd, Err: err})
+	}
+	return msgs, err
+}
+
 func ipsetExecute(req *nl.NetlinkRequest) (msgs [][]byte, err error) {
 	msgs, err = req.Execute(unix.NETLINK_NETFILTER, 0)
 
 	if err != nil {
-		if errno := int(err.(syscall.Errno)); errno >= IPSET_ERR_PRIVATE {
+		if errno, ok := err.(syscall.Errno); ok && int(errno) >= IPSET_ERR_PRIVATE {
 			err = IPSetError(uintptr(errno))
 		}
 	}
@@ -345,8 +787,10 @@ func (result *Sets) unserialize(msg []byte) {
 			result.parseAttrADT(attr.Value)
 		case IPSET_ATTR_PROTOCOL_MIN:
 			result.ProtocolMinVersion = attr.Value[0]
-		case IPSET_ATTR_MARKMASK:
-			result.MarkMask = attr.Uint32()
+		case IPSET_ATTR_INDEX, IPSET_ATTR_INDEX | nl.NLA_F_NET_BYTEORDER:
+			// the markmask of hash:ip,mark is part of IPSET_ATTR_DATA,
+			// at this level attribute 11 is the index of protocol 7
+			result.Index = ntohs(attr.Value)
 		default:
 			log.Printf("unknown ipset attribute from kernel: %+v %v", attr, attr.Type&nl.NLA_TYPE_MASK)
 		}
@@ -363,6 +807,7 @@ func (result *Sets) parseAttrData(data []byte) {
 		case IPSET_ATTR_TIMEOUT | nl.NLA_F_NET_BYTEORDER:
 			val := attr.Uint32()
 			result.Timeout = &val
+			result.TTL = secondsPtr(val)
 		case IPSET_ATTR_ELEMENTS | nl.NLA_F_NET_BYTEORDER:
 			result.NumEntries = attr.Uint32()
 		case IPSET_ATTR_REFERENCES | nl.NLA_F_NET_BYTEORDER:
@@ -383,14 +828,7 @@ func (result *Sets) parseAttrData(data []byte) {
 				}
 			}
 		case IPSET_ATTR_IP_TO | nl.NLA_F_NESTED:
-			for nested := range nl.ParseAttributes(attr.Value) {
-				switch nested.Type {
-				case IPSET_ATTR_IP:
-					result.IPTo = nested.Value
-				default:
-					log.Printf("unknown nested ipset data attribute from kernel: %+v %v", nested, nested.Type&nl.NLA_TYPE_MASK)
-				}
-			}
+			result.IPTo = parseIPAttr(attr.Value)
 		case IPSET_ATTR_PORT_FROM | nl.NLA_F_NET_BYTEORDER:
 			result.PortFrom = ntohs(attr.Value)
 		case IPSET_ATTR_PORT_TO | nl.NLA_F_NET_BYTEORDER:
@@ -401,8 +839,16 @@ func (result *Sets) parseAttrData(data []byte) {
 			result.Comment = nl.BytesToString(attr.Value)
 		case IPSET_ATTR_SIZE | nl.NLA_F_NET_BYTEORDER:
 			result.Size = attr.Uint32()
-		case IPSET_ATTR_MARKMASK:
+		case IPSET_ATTR_NETMASK:
+			result.NetMask = attr.Value[0]
+		case IPSET_ATTR_BITMASK | nl.NLA_F_NESTED:
+			result.BitMask = parseIPAttr(attr.Value)
+		case IPSET_ATTR_MARKMASK, IPSET_ATTR_MARKMASK | nl.NLA_F_NET_BYTEORDER:
 			result.MarkMask = attr.Uint32()
+		case IPSET_ATTR_BUCKETSIZE:
+			result.BucketSize = attr.Value[0]
+		case IPSET_ATTR_INITVAL | nl.NLA_F_NET_BYTEORDER:
+			result.InitVal = attr.Uint32()
 		default:
 			log.Printf("unknown ipset data attribute from kernel: %+v %v", attr, attr.Type&nl.NLA_TYPE_MASK)
 		}
@@ -426,6 +872,7 @@ func parseIPSetEntry(data []byte) (entry Entry) {
 		case IPSET_ATTR_TIMEOUT | nl.NLA_F_NET_BYTEORDER:
 			val := attr.Uint32()
 			entry.Timeout = &val
+			entry.TTL = secondsPtr(val)
 		case IPSET_ATTR_BYTES | nl.NLA_F_NET_BYTEORDER:
 			val := attr.Uint64()
 			entry.Bytes = &val
@@ -439,23 +886,11 @@ func parseIPSetEntry(data []byte) (entry Entry) {
 		case IPSET_ATTR_COMMENT:
 			entry.Comment = nl.BytesToString(attr.Value)
 		case IPSET_ATTR_IP | nl.NLA_F_NESTED:
-			for attr := range nl.ParseAttributes(attr.Value) {
-				switch attr.Type {
-				case IPSET_ATTR_IP:
-					entry.IP = net.IP(attr.Value)
-				default:
-					log.Printf("unknown nested ADT attribute from kernel: %+v", attr)
-				}
-			}
+			entry.IP = parseIPAttr(attr.Value)
+		case IPSET_ATTR_IP_TO | nl.NLA_F_NESTED:
+			entry.IPTo = parseIPAttr(attr.Value)
 		case IPSET_ATTR_IP2 | nl.NLA_F_NESTED:
-			for attr := range nl.ParseAttributes(attr.Value) {
-				switch attr.Type {
-				case IPSET_ATTR_IP:
-					entry.IP2 = net.IP(attr.Value)
-				default:
-					log.Printf("unknown nested ADT attribute from kernel: %+v", attr)
-				}
-			}
+			entry.IP2 = parseIPAttr(attr.Value)
 		case IPSET_ATTR_CIDR:
 			entry.CIDR = attr.Value[0]
 		case IPSET_ATTR_CIDR2:
@@ -473,9 +908,35 @@ func parseIPSetEntry(data []byte) (entry Entry) {
 		case IPSET_ATTR_MARK | nl.NLA_F_NET_BYTEORDER:
 			val := attr.Uint32()
 			entry.Mark = &val
+		case IPSET_ATTR_CADT_FLAGS | nl.NLA_F_NET_BYTEORDER:
+			entry.NoMatch = attr.Uint32()&IPSET_FLAG_NOMATCH != 0
+		case IPSET_ATTR_SKBMARK | nl.NLA_F_NET_BYTEORDER:
+			val := attr.Uint64()
+			mark, mask := uint32(val>>32), uint32(val)
+			entry.SkbMark = &mark
+			entry.SkbMask = &mask
+		case IPSET_ATTR_SKBPRIO | nl.NLA_F_NET_BYTEORDER:
+			val := attr.Uint32()
+			entry.SkbPrio = &val
+		case IPSET_ATTR_SKBQUEUE | nl.NLA_F_NET_BYTEORDER:
+			val := ntohs(attr.Value)
+			entry.SkbQueue = &val
 		default:
 			log.Printf("unknown ADT attribute from kernel: %+v", attr)
 		}
 	}
 	return
 }
+
+// parseIPAttr returns the IPv4 or IPv6 address of a nested address attribute.
+func parseIPAttr(data []byte) (ip net.IP) {
+	for attr := range nl.ParseAttributes(data) {
+		switch attr.Type & nl.NLA_TYPE_MASK {
+		case IPSET_ATTR_IPADDR_IPV4, IPSET_ATTR_IPADDR_IPV6:
+			ip = net.IP(attr.Value)
+		default:
+			log.Printf("unknown nested ADT attribute from kernel: %+v", attr)
+		}
+	}
+	return ip
+}
@@ -2,9 +2,17 @@
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"net"
+	"net/netip"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
 )
 
 func TestParseIpsetProtocolResult(t *testing.T) {
@@ -192,6 +200,21 @@ func TestHashMethodCreateListAddDelDestroy(t *testing.T) {
 				Replace:  false,
 			},
 		},
+		{
+			desc:     "Type-hash:ip,port-icmp",
+			setname:  "my-test-ipset-6-icmp",
+			typename: TypeHashIPPort,
+			options: CreateOptions{
+				Replace: true,
+				Timeout: timeout,
+			},
+			entry: &Entry{
+				IP:       net.ParseIP("10.99.99.1").To4(),
+				Protocol: Uint8Ptr(uint8(ProtocolICMP)),
+				Port:     Uint16Ptr(ICMPTypeCode(8, 0)),
+				Replace:  false,
+			},
+		},
 		{
 			desc:     "Type-hash:net,port,net",
 			setname:  "my-test-ipset-7",
@@ -671,3 +694,751 @@ func assertIPSetEntryEqual(t *testing.T, except *Entry, actual *Entry) {
 		t.Fatalf("expected name to be '%s', got '%s'", except.Name, actual.Name)
 	}
 }
+
+func TestGetByNameIndex(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	h, err := NewHandle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	protocol, err := h.ProtocolVersion()
+	if err != nil {
+		t.Skip("ipset is not available: ", err)
+	}
+	if protocol < 7 {
+		if _, _, err := h.GetByName("set1"); err == nil {
+			t.Fatal("expected GetByName to require protocol 7")
+		}
+		t.Skipf("kernel speaks protocol %d", protocol)
+	}
+
+	if err := h.Create("set1", TypeHashIP, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Create("set2", TypeHashNet, CreateOptions{Family: FamilyIPV6}); err != nil {
+		t.Fatal(err)
+	}
+
+	index, family, err := h.GetByName("set2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if family != FamilyIPV6 {
+		t.Errorf("expected family %d, got %d", FamilyIPV6, family)
+	}
+	name, err := h.GetByIndex(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "set2" {
+		t.Errorf("expected set2 at index %d, got %q", index, name)
+	}
+
+	if _, _, err := h.GetByName("set3"); err == nil {
+		t.Error("expected missing set to fail")
+	}
+}
+
+func TestHashIPMasks(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	for _, tc := range []struct {
+		setname string
+		options CreateOptions
+		member  net.IP
+		outside net.IP
+	}{
+		{"netmask", CreateOptions{NetMask: 24}, net.ParseIP("10.0.0.200"), net.ParseIP("10.0.1.1")},
+		{"netmask6", CreateOptions{Family: FamilyIPV6, NetMask: 64}, net.ParseIP("2001:db8::ffff"), net.ParseIP("2001:db8:0:1::1")},
+		{"bitmask", CreateOptions{BitMask: net.ParseIP("255.255.0.255")}, net.ParseIP("10.0.99.1"), net.ParseIP("10.0.0.2")},
+	} {
+		err := Create(tc.setname, TypeHashIP, tc.options)
+		if err == ErrInvalidType {
+			t.Logf("%s: revision not supported by the kernel", tc.setname)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.setname, err)
+		}
+
+		set, err := List(tc.setname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint32(set.NetMask) != tc.options.NetMask || !set.BitMask.Equal(tc.options.BitMask) {
+			t.Errorf("%s: unexpected masks %d %v", tc.setname, set.NetMask, set.BitMask)
+		}
+
+		first := net.ParseIP("10.0.0.1")
+		if tc.options.Family == FamilyIPV6 {
+			first = net.ParseIP("2001:db8::1")
+		} else {
+			first = first.To4()
+		}
+		if err := Add(tc.setname, &Entry{IP: first}); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := Test(tc.setname, &Entry{IP: tc.member}); err != nil || !ok {
+			t.Errorf("%s: expected %s to match, got %v", tc.setname, tc.member, err)
+		}
+		if ok, err := Test(tc.setname, &Entry{IP: tc.outside}); err != nil || ok {
+			t.Errorf("%s: expected %s not to match, got %v", tc.setname, tc.outside, err)
+		}
+	}
+}
+
+func TestOwnerGC(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	o, err := NewOwner(nil, "ctl-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"keep", "orphan", "member", "held"} {
+		if err := o.Create(name, TypeHashIP, CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.Create("list", TypeListSet, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(o.SetName("list"), &Entry{Name: o.SetName("member")}); err != nil {
+		t.Fatal(err)
+	}
+	// a set of another controller holds one of ours
+	if err := Create("other-list", TypeListSet, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add("other-list", &Entry{Name: o.SetName("held")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Create("this-name-is-far-too-long-for-ipset", TypeHashIP, CreateOptions{}); err == nil {
+		t.Error("expected a long name to be rejected")
+	}
+
+	result, err := o.GC([]string{"keep"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"ctl-list", "ctl-member", "ctl-orphan"}
+	sort.Strings(result.Destroyed)
+	if !reflect.DeepEqual(result.Destroyed, expected) {
+		t.Errorf("expected %v destroyed, got %v", expected, result.Destroyed)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].SetName != "ctl-held" {
+		t.Errorf("unexpected skipped %+v", result.Skipped)
+	}
+
+	owned, err := o.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owned) != 2 {
+		t.Errorf("expected ctl-keep and ctl-held to remain, got %d sets", len(owned))
+	}
+	if _, err := List("other-list"); err != nil {
+		t.Errorf("expected sets of others to be left alone: %v", err)
+	}
+}
+
+func TestSafeDestroy(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	for _, name := range []string{"member", "free"} {
+		if err := Create(name, TypeHashIP, CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Create("holder", TypeListSet, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add("holder", &Entry{Name: "member"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := pkgHandle.SafeDestroy("member", nil)
+	var inUse *InUseError
+	if !errors.As(err, &inUse) || inUse.References != 1 || !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected InUseError, got %v", err)
+	}
+	if _, err := List("member"); err != nil {
+		t.Errorf("expected member to remain: %v", err)
+	}
+	if err := pkgHandle.SafeDestroy("free", nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// largeBatch returns n IPv6 entries with a timeout and a comment, which
+// overflow a single ADT attribute.
+func largeBatch(n int) []*Entry {
+	entries := make([]*Entry, n)
+	for i := range entries {
+		ip := net.ParseIP("2001:db8::")
+		ip[14], ip[15] = byte(i>>8), byte(i)
+		entries[i] = &Entry{IP: ip, Timeout: Uint32Ptr(600), Comment: "batched entry"}
+	}
+	return entries
+}
+
+func TestSplitBatch(t *testing.T) {
+	entries := largeBatch(1024)
+	batches, err := splitBatch(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) < 2 {
+		t.Fatalf("expected several batches, got %d", len(batches))
+	}
+	var count int
+	for _, batch := range batches {
+		adt := nl.NewRtAttr(IPSET_ATTR_ADT|int(nl.NLA_F_NESTED), nil)
+		for i, entry := range batch {
+			data, err := entryData(entry, uint32(i+1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			adt.AddChild(data)
+		}
+		if adt.Len() > 0xffff {
+			t.Errorf("ADT of %d bytes overflows its length", adt.Len())
+		}
+		count += len(batch)
+	}
+	if count != len(entries) {
+		t.Errorf("expected %d entries, got %d", len(entries), count)
+	}
+
+	if _, err := splitBatch([]*Entry{{Comment: strings.Repeat("x", 0x10000)}}); err == nil {
+		t.Error("expected an oversized entry to be rejected")
+	}
+}
+
+func TestAddBatch(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	if err := Create("batch", TypeHashIP, CreateOptions{Family: FamilyIPV6, Timeout: 600, Comments: true}); err != nil {
+		t.Fatal(err)
+	}
+	entries := largeBatch(1024)
+	if err := AddBatch("batch", entries); err != nil {
+		t.Fatal(err)
+	}
+	set, err := List("batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Entries) != len(entries) {
+		t.Errorf("expected %d entries, got %d", len(entries), len(set.Entries))
+	}
+
+	if err := DelBatch("batch", entries); err != nil {
+		t.Fatal(err)
+	}
+	if set, err = List("batch"); err != nil || len(set.Entries) != 0 {
+		t.Errorf("expected an empty set, got %v, %v", set, err)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	opts := CreateOptions{Comments: true, Counters: true, Skbinfo: true}
+	opts.SetTTL(time.Minute)
+	if err := Create("touched", TypeHashIP, opts); err != nil {
+		t.Fatal(err)
+	}
+	packets := uint64(3)
+	entry := &Entry{IP: net.ParseIP("10.0.0.1").To4(), Comment: "client", Packets: &packets, SkbPrio: Uint32Ptr(0x10002)}
+	if err := Add("touched", entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Touch("touched", &Entry{IP: entry.IP}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	set, err := List("touched")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(set.Entries))
+	}
+	e := set.Entries[0]
+	if e.TTL == nil || *e.TTL <= time.Minute || e.Comment != "client" || e.Packets == nil || *e.Packets != 3 ||
+		e.SkbPrio == nil || *e.SkbPrio != 0x10002 {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	err = Touch("touched", &Entry{IP: net.ParseIP("10.0.0.2").To4()}, time.Hour)
+	if err != ErrEntryNotExist {
+		t.Errorf("expected ErrEntryNotExist, got %v", err)
+	}
+}
+
+func TestCreateDualStack(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	if err := CreateDualStack("dual", TypeHashNet, CreateOptions{Comments: true}); err != nil {
+		t.Fatal(err)
+	}
+	v4, v6 := DualStackNames("dual")
+	for name, family := range map[string]uint8{v4: FamilyIPV4, v6: FamilyIPV6} {
+		set, err := List(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if set.Family != family || set.CadtFlags&IPSET_FLAG_WITH_COMMENT == 0 {
+			t.Errorf("unexpected header of %s: family %d, flags %#x", name, set.Family, set.CadtFlags)
+		}
+	}
+
+	entries := []*Entry{
+		{IP: net.ParseIP("10.0.0.0").To4(), CIDR: 8},
+		{IP: net.ParseIP("2001:db8::"), CIDR: 32},
+	}
+	for _, entry := range entries {
+		if err := AddDualStack("dual", entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{v4, v6} {
+		if set, err := List(name); err != nil || len(set.Entries) != 1 {
+			t.Fatalf("expected one entry in %s: %v", name, err)
+		}
+	}
+	if ok, err := TestDualStack("dual", &Entry{IP: net.ParseIP("2001:db8::1")}); !ok || err != nil {
+		t.Errorf("expected 2001:db8::1 to be in dual: %v", err)
+	}
+	if err := DelDualStack("dual", entries[1]); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := TestDualStack("dual", &Entry{IP: net.ParseIP("2001:db8::1")}); ok {
+		t.Error("expected 2001:db8::1 to be deleted")
+	}
+	if err := AddDualStack("dual", &Entry{Name: "other"}); err == nil {
+		t.Error("expected an error for an entry without address")
+	}
+	if err := DestroyDualStack("dual"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed replace keeps the half that existed before
+	live4, live6 := DualStackNames("live")
+	if err := Create(live4, TypeHashNet, CreateOptions{Family: FamilyIPV4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(live6, TypeHashIP, CreateOptions{Family: FamilyIPV6}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateDualStack("live", TypeHashNet, CreateOptions{Replace: true}); err == nil {
+		t.Fatal("expected the incompatible v6 half to fail")
+	}
+	if _, err := List(live4); err != nil {
+		t.Errorf("expected %s to survive the rollback: %v", live4, err)
+	}
+}
+
+func TestRequestFamily(t *testing.T) {
+	h := &Handle{protocol: IPSET_PROTOCOL}
+	for _, family := range []uint8{FamilyUnspec, FamilyIPV4, FamilyIPV6} {
+		req := h.newRequestFamily(IPSET_CMD_LIST, family)
+		if msg := req.Data[0].(*nl.Nfgenmsg); msg.NfgenFamily != family {
+			t.Errorf("expected family %d, got %d", family, msg.NfgenFamily)
+		}
+	}
+}
+
+func TestDualSet(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	d := NewDualSet(nil, "peers", TypeHashIP, CreateOptions{Comments: true, Counters: true})
+	d.Combined = true
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if set, err := List("peers"); err != nil || len(set.Entries) != 2 {
+		t.Fatalf("expected the list:set to hold both halves: %v", err)
+	}
+
+	if err := d.Add(&Entry{IP: net.ParseIP("10.0.0.1").To4()}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := d.Test(&Entry{IP: net.ParseIP("10.0.0.1").To4()}); !ok || err != nil {
+		t.Fatalf("expected 10.0.0.1 to be in the set: %v", err)
+	}
+
+	err := d.Sync([]*Entry{
+		{IP: net.ParseIP("10.0.0.2").To4(), Comment: "b"},
+		{IP: net.ParseIP("2001:db8::1"), Comment: "c"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.IP.String()+" "+e.Comment)
+	}
+	if expected := []string{"10.0.0.2 b", "2001:db8::1 c"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	// more than an attribute holds
+	large := largeBatch(3000)
+	for _, e := range large {
+		e.Timeout = nil
+	}
+	if err := d.Sync(large); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err = d.List(); err != nil || len(entries) != len(large) {
+		t.Fatalf("expected %d entries, got %d: %v", len(large), len(entries), err)
+	}
+
+	v4, _ := d.Names()
+	if err := Destroy(v4); err == nil {
+		t.Fatal("expected the IPv4 half to be busy")
+	}
+	if err := d.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed replace keeps the sets that existed before
+	if err := CreateDualStack("kept", TypeHashIP, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddDualStack("kept", &Entry{IP: net.ParseIP("10.0.0.1").To4()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create("kept", TypeHashIP, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	kept := NewDualSet(nil, "kept", TypeHashIP, CreateOptions{Replace: true})
+	kept.Combined = true
+	if err := kept.Create(); err == nil {
+		t.Fatal("expected the list:set to clash with the hash:ip set")
+	}
+	if set, err := List("kept"); err != nil || set.TypeName != TypeHashIP {
+		t.Errorf("expected the hash:ip set to be kept: %v", err)
+	}
+	if ok, err := kept.Test(&Entry{IP: net.ParseIP("10.0.0.1").To4()}); !ok || err != nil {
+		t.Errorf("expected the IPv4 half to be kept: %v", err)
+	}
+
+	Create("odd-v4", TypeHashIP, CreateOptions{Family: FamilyIPV4, Comments: true})
+	Create("odd-v6", TypeHashIP, CreateOptions{Family: FamilyIPV6})
+	if err := NewDualSet(nil, "odd", TypeHashIP, CreateOptions{}).Check(); err == nil {
+		t.Error("expected halves with different options to be reported")
+	}
+}
+
+func TestBitmapRange(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	opts, err := BitmapIPOptions(netip.MustParsePrefix("10.0.0.0/16"), 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Create("subnets", TypeBitmapIP, opts); err != nil {
+		t.Fatal(err)
+	}
+	set, err := List("subnets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.NetMask != 24 {
+		t.Errorf("expected netmask 24, got %d", set.NetMask)
+	}
+
+	err = Add("subnets", &Entry{IP: net.ParseIP("10.1.0.1").To4()})
+	var rangeErr *BitmapRangeError
+	if !errors.As(err, &rangeErr) || rangeErr.Range != "10.0.0.0-10.0.255.255" {
+		t.Fatalf("expected a range error, got %v", err)
+	}
+	if !errors.Is(err, IPSetError(IPSET_ERR_BITMAP_RANGE)) {
+		t.Error("expected the kernel error to be wrapped")
+	}
+
+	if err := Create("too-large", TypeBitmapIP, CreateOptions{IPFrom: net.ParseIP("10.0.0.0"), IPTo: net.ParseIP("10.1.0.0")}); err == nil {
+		t.Error("expected a range of more than 65536 addresses to be refused")
+	}
+}
+
+func TestGrowPolicy(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	if err := Create("blocklist", TypeHashIP, CreateOptions{MaxElements: 4, Comments: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create("rules", TypeListSet, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add("rules", &Entry{Name: "blocklist"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ip := func(i int) net.IP { return net.IPv4(10, 0, 0, byte(i)).To4() }
+	for i := 0; i < 4; i++ {
+		if err := Add("blocklist", &Entry{IP: ip(i), Comment: "old"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Add("blocklist", &Entry{IP: ip(4)}); err != ErrHashFull {
+		t.Fatalf("expected ErrHashFull, got %v", err)
+	}
+
+	var events []GrowEvent
+	SetGrowPolicy(&GrowPolicy{Limit: 16, OnGrow: func(e GrowEvent) { events = append(events, e) }})
+	defer SetGrowPolicy(nil)
+
+	for i := 4; i < 16; i++ {
+		if err := Add("blocklist", &Entry{IP: ip(i)}); err != nil {
+			t.Fatalf("add %d: %v", i, err)
+		}
+	}
+	if err := AddBatch("blocklist", []*Entry{{IP: ip(16)}}); err != ErrHashFull {
+		t.Fatalf("expected ErrHashFull at the limit, got %v", err)
+	}
+
+	if len(events) != 3 || events[0].NewMaxElements != 8 || events[0].Entries != 4 || events[1].NewMaxElements != 16 || events[2].Err == nil {
+		t.Errorf("unexpected events %+v", events)
+	}
+
+	set, err := List("blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.MaxElements != 16 || len(set.Entries) != 16 || set.References != 1 || set.CadtFlags&IPSET_FLAG_WITH_COMMENT == 0 {
+		t.Errorf("unexpected set: maxelem %d, %d entries, %d references", set.MaxElements, len(set.Entries), set.References)
+	}
+	if e := set.Find(&Entry{IP: ip(0)}); e == nil || e.Comment != "old" {
+		t.Errorf("expected the comment to be copied, got %+v", e)
+	}
+	all, err := ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected the temporary sets to be destroyed, got %d sets", len(all))
+	}
+}
+
+func TestClone(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	for _, tc := range []struct {
+		typename string
+		options  CreateOptions
+		entry    string
+	}{
+		{TypeHashIP, CreateOptions{Timeout: 600, Counters: true, Comments: true, NetMask: 24, MaxElements: 100}, "10.0.0.0"},
+		{TypeHashNet, CreateOptions{Family: FamilyIPV6, Skbinfo: true}, "2001:db8::/32"},
+		{TypeHashIPPort, CreateOptions{Timeout: 60, ForceAdd: true}, "10.0.0.1,udp:53"},
+		{TypeBitmapPort, CreateOptions{PortFrom: 1000, PortTo: 2000, Counters: true}, "1500"},
+		{TypeBitmapIP, CreateOptions{IPFrom: net.ParseIP("10.0.0.0"), IPTo: net.ParseIP("10.255.255.255"), NetMask: 16}, "10.1.0.0"},
+		{TypeListSet, CreateOptions{Size: 4}, ""},
+	} {
+		t.Run(tc.typename, func(t *testing.T) {
+			if err := Create("src", tc.typename, tc.options); err != nil {
+				t.Fatal(err)
+			}
+			defer Destroy("src")
+			if tc.entry != "" {
+				args := []string{tc.entry}
+				if tc.options.Comments {
+					args = append(args, "comment", "x")
+				}
+				entry, err := ParseEntry(tc.typename, args...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := Add("src", entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, withEntries := range []bool{false, true} {
+				if err := Clone("src", "dst", withEntries); err != nil {
+					t.Fatal(err)
+				}
+				src, _ := List("src")
+				dst, err := List("dst")
+				Destroy("dst")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if a, b := strings.Join(src.HeaderOptions(), " "), strings.Join(dst.HeaderOptions(), " "); a != b || src.Revision != dst.Revision {
+					t.Errorf("expected header %q revision %d, got %q revision %d", a, src.Revision, b, dst.Revision)
+				}
+				expected := 0
+				if withEntries {
+					expected = len(src.Entries)
+				}
+				if len(dst.Entries) != expected {
+					t.Errorf("expected %d entries, got %d", expected, len(dst.Entries))
+				}
+			}
+		})
+	}
+
+	// entries with extensions overflow a batch of a fixed count
+	if err := Create("large", TypeHashIP, CreateOptions{Family: FamilyIPV6, Timeout: 600, Comments: true, Counters: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddBatch("large", largeBatch(3000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Clone("large", "large-copy", true); err != nil {
+		t.Fatal(err)
+	}
+	if set, err := List("large-copy"); err != nil || len(set.Entries) != 3000 {
+		t.Errorf("expected 3000 entries to be copied: %v", err)
+	}
+}
+
+func TestWriteSet(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	a := &Sets{SetName: "a", TypeName: TypeHashNet, Family: FamilyIPV4, HashSize: 1024, MaxElements: 65536, CadtFlags: IPSET_FLAG_WITH_COMMENT}
+	a.Entries = []Entry{{IP: net.ParseIP("10.0.0.0").To4(), CIDR: 8, Comment: "a"}}
+	b := &Sets{SetName: "b", TypeName: TypeHashNet, Family: FamilyIPV4}
+	b.Entries = []Entry{{IP: net.ParseIP("10.128.0.0").To4(), CIDR: 9}}
+
+	result, err := Difference(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSet(result.SetName, result); err == nil {
+		t.Fatal("expected the unnamed result to be refused")
+	}
+	if err := WriteSet("a-minus-b", result); err != nil {
+		t.Fatal(err)
+	}
+	// writing to an existing set updates it
+	if err := WriteSet("a-minus-b", result); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := List("a-minus-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Entries) != 1 || set.Entries[0].CIDR != 9 || set.CadtFlags&IPSET_FLAG_WITH_COMMENT == 0 {
+		t.Errorf("unexpected set %+v", set)
+	}
+	if ok, _ := Test("a-minus-b", &Entry{IP: net.ParseIP("10.200.0.1").To4()}); ok {
+		t.Error("expected 10.200.0.1 not to be in the set")
+	}
+}
+
+func TestAddRangeExpanded(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	for _, tc := range []struct {
+		typename string
+		options  CreateOptions
+		entry    *Entry
+		entries  int
+	}{
+		{TypeHashNet, CreateOptions{Family: FamilyIPV6}, &Entry{IP: net.ParseIP("2001:db8::1"), IPTo: net.ParseIP("2001:db8::6")}, 4},
+		{TypeHashIP, CreateOptions{Family: FamilyIPV6}, &Entry{IP: net.ParseIP("2001:db8::1"), IPTo: net.ParseIP("2001:db8::6")}, 6},
+		{TypeBitmapIPMac, CreateOptions{IPFrom: net.ParseIP("10.0.0.0"), IPTo: net.ParseIP("10.0.0.255")},
+			&Entry{IP: net.ParseIP("10.0.0.1").To4(), IPTo: net.ParseIP("10.0.0.3").To4(), MAC: mac}, 3},
+	} {
+		if err := Create("range", tc.typename, tc.options); err != nil {
+			t.Fatal(err)
+		}
+		if err := Add("range", tc.entry); err != nil {
+			t.Fatalf("%s: %v", tc.typename, err)
+		}
+		set, err := List("range")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(set.Entries) != tc.entries {
+			t.Errorf("%s: expected %d entries, got %d", tc.typename, tc.entries, len(set.Entries))
+		}
+		if err := Del("range", tc.entry); err != nil {
+			t.Fatalf("%s: %v", tc.typename, err)
+		}
+		if set, _ := List("range"); len(set.Entries) != 0 {
+			t.Errorf("%s: expected the range to be deleted", tc.typename)
+		}
+		Destroy("range")
+	}
+
+	// a malformed request is not mistaken for a range the type refuses
+	if err := Create("range", TypeHashIPPort, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var adds int
+	SetTrace(func(m TraceMessage) {
+		if m.Request && m.Cmd == IPSET_CMD_ADD {
+			adds++
+		}
+	})
+	defer SetTrace(nil)
+	err := Add("range", &Entry{IP: net.ParseIP("10.0.0.1").To4(), IPTo: net.ParseIP("10.0.0.200").To4()})
+	if err != ErrInvalidProtocol || adds != 1 {
+		t.Errorf("expected a single refused add, got %d adds: %v", adds, err)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	var msgs []TraceMessage
+	SetTrace(func(m TraceMessage) { msgs = append(msgs, m) })
+	defer SetTrace(nil)
+
+	if err := Create("traced", TypeHashIP, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create("traced", TypeHashIP, CreateOptions{}); err == nil {
+		t.Fatal("expected the set to exist")
+	}
+
+	var creates, errs int
+	for _, m := range msgs {
+		if m.Cmd != IPSET_CMD_CREATE {
+			continue
+		}
+		if m.Request {
+			creates++
+			if s := m.String(); !strings.Contains(s, `setname: "traced"`) || !strings.Contains(s, "typename: \"hash:ip\"") {
+				t.Errorf("unexpected trace %s", s)
+			}
+		}
+		if m.Err != nil {
+			errs++
+		}
+	}
+	if creates != 2 || errs != 1 {
+		t.Errorf("expected 2 create requests and 1 error, got %d and %d", creates, errs)
+	}
+}
@@ -0,0 +1,465 @@
+package ipset
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// entryJSON is the JSON and YAML representation of an Entry.
+type entryJSON struct {
+	Name     string  `json:"name,omitempty" yaml:"name,omitempty"`
+	IP       string  `json:"ip,omitempty" yaml:"ip,omitempty"`
+	IPTo     string  `json:"ip_to,omitempty" yaml:"ip_to,omitempty"`
+	CIDR     uint8   `json:"cidr,omitempty" yaml:"cidr,omitempty"`
+	IP2      string  `json:"ip2,omitempty" yaml:"ip2,omitempty"`
+	CIDR2    uint8   `json:"cidr2,omitempty" yaml:"cidr2,omitempty"`
+	MAC      string  `json:"mac,omitempty" yaml:"mac,omitempty"`
+	Protocol string  `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	Port     *uint16 `json:"port,omitempty" yaml:"port,omitempty"`
+	PortTo   *uint16 `json:"port_to,omitempty" yaml:"port_to,omitempty"`
+	ICMP     string  `json:"icmp,omitempty" yaml:"icmp,omitempty"`
+	IFace    string  `json:"iface,omitempty" yaml:"iface,omitempty"`
+	Mark     *uint32 `json:"mark,omitempty" yaml:"mark,omitempty"`
+	NoMatch  bool    `json:"nomatch,omitempty" yaml:"nomatch,omitempty"`
+	Timeout  *uint32 `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Packets  *uint64 `json:"packets,omitempty" yaml:"packets,omitempty"`
+	Bytes    *uint64 `json:"bytes,omitempty" yaml:"bytes,omitempty"`
+	Comment  string  `json:"comment,omitempty" yaml:"comment,omitempty"`
+	SkbMark  *uint32 `json:"skbmark,omitempty" yaml:"skbmark,omitempty"`
+	SkbMask  *uint32 `json:"skbmask,omitempty" yaml:"skbmask,omitempty"`
+	SkbPrio  *uint32 `json:"skbprio,omitempty" yaml:"skbprio,omitempty"`
+	SkbQueue *uint16 `json:"skbqueue,omitempty" yaml:"skbqueue,omitempty"`
+	Replace  bool    `json:"replace,omitempty" yaml:"replace,omitempty"`
+}
+
+// setsJSON is the JSON and YAML representation of Sets.
+type setsJSON struct {
+	Name         string   `json:"name" yaml:"name"`
+	Type         string   `json:"type" yaml:"type"`
+	Revision     uint8    `json:"revision" yaml:"revision"`
+	Family       string   `json:"family,omitempty" yaml:"family,omitempty"`
+	Comment      string   `json:"comment,omitempty" yaml:"comment,omitempty"`
+	HashSize     uint32   `json:"hashsize,omitempty" yaml:"hashsize,omitempty"`
+	MaxElements  uint32   `json:"maxelem,omitempty" yaml:"maxelem,omitempty"`
+	Size         uint32   `json:"size,omitempty" yaml:"size,omitempty"`
+	IPFrom       string   `json:"ip_from,omitempty" yaml:"ip_from,omitempty"`
+	IPTo         string   `json:"ip_to,omitempty" yaml:"ip_to,omitempty"`
+	PortFrom     uint16   `json:"port_from,omitempty" yaml:"port_from,omitempty"`
+	PortTo       uint16   `json:"port_to,omitempty" yaml:"port_to,omitempty"`
+	NetMask      uint8    `json:"netmask,omitempty" yaml:"netmask,omitempty"`
+	BitMask      string   `json:"bitmask,omitempty" yaml:"bitmask,omitempty"`
+	MarkMask     uint32   `json:"markmask,omitempty" yaml:"markmask,omitempty"`
+	Timeout      *uint32  `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Flags        []string `json:"flags,omitempty" yaml:"flags,omitempty"`
+	References   uint32   `json:"references" yaml:"references"`
+	SizeInMemory uint32   `json:"memsize" yaml:"memsize"`
+	NumEntries   uint32   `json:"numentries" yaml:"numentries"`
+	Entries      []Entry  `json:"entries" yaml:"entries"`
+}
+
+// createOptionsJSON is the JSON and YAML representation of CreateOptions.
+type createOptionsJSON struct {
+	Family      string   `json:"family,omitempty" yaml:"family,omitempty"`
+	Revision    uint8    `json:"revision,omitempty" yaml:"revision,omitempty"`
+	Size        uint32   `json:"size,omitempty" yaml:"size,omitempty"`
+	MaxElements uint32   `json:"maxelem,omitempty" yaml:"maxelem,omitempty"`
+	Timeout     uint32   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Flags       []string `json:"flags,omitempty" yaml:"flags,omitempty"`
+	IPFrom      string   `json:"ip_from,omitempty" yaml:"ip_from,omitempty"`
+	IPTo        string   `json:"ip_to,omitempty" yaml:"ip_to,omitempty"`
+	NetMask     uint32   `json:"netmask,omitempty" yaml:"netmask,omitempty"`
+	BitMask     string   `json:"bitmask,omitempty" yaml:"bitmask,omitempty"`
+	MarkMask    uint32   `json:"markmask,omitempty" yaml:"markmask,omitempty"`
+	PortFrom    uint16   `json:"port_from,omitempty" yaml:"port_from,omitempty"`
+	PortTo      uint16   `json:"port_to,omitempty" yaml:"port_to,omitempty"`
+	Replace     bool     `json:"replace,omitempty" yaml:"replace,omitempty"`
+}
+
+var cadtFlagNames = []struct {
+	flag uint32
+	name string
+}{
+	{IPSET_FLAG_WITH_COUNTERS, "counters"},
+	{IPSET_FLAG_WITH_COMMENT, "comment"},
+	{IPSET_FLAG_WITH_SKBINFO, "skbinfo"},
+	{IPSET_FLAG_WITH_FORCEADD, "forceadd"},
+}
+
+func cadtFlagsToNames(flags uint32) []string {
+	var names []string
+	for _, f := range cadtFlagNames {
+		if flags&f.flag != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+func namesToCadtFlags(names []string) (uint32, error) {
+	var flags uint32
+next:
+	for _, name := range names {
+		for _, f := range cadtFlagNames {
+			if f.name == name {
+				flags |= f.flag
+				continue next
+			}
+		}
+		return 0, fmt.Errorf("unknown flag: %q", name)
+	}
+	return flags, nil
+}
+
+func ipToString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+func stringToIP(s, field string) (net.IP, error) {
+	if s == "" {
+		return nil, nil
+	}
+	ip := parseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid %s: %q", field, s)
+	}
+	return ip, nil
+}
+
+func familyFromString(s string) (uint8, error) {
+	if s == "" || s == "unspec" {
+		return FamilyUnspec, nil
+	}
+	return ParseFamily(s)
+}
+
+func (e *Entry) toJSON() entryJSON {
+	v := entryJSON{
+		Name:     e.Name,
+		IP:       ipToString(e.IP),
+		IPTo:     ipToString(e.IPTo),
+		CIDR:     e.CIDR,
+		IP2:      ipToString(e.IP2),
+		CIDR2:    e.CIDR2,
+		Port:     e.Port,
+		PortTo:   e.PortTo,
+		IFace:    e.IFace,
+		Mark:     e.Mark,
+		NoMatch:  e.NoMatch,
+		Timeout:  e.timeout(),
+		Packets:  e.Packets,
+		Bytes:    e.Bytes,
+		Comment:  e.Comment,
+		SkbMark:  e.SkbMark,
+		SkbMask:  e.SkbMask,
+		SkbPrio:  e.SkbPrio,
+		SkbQueue: e.SkbQueue,
+		Replace:  e.Replace,
+	}
+	if e.MAC != nil {
+		v.MAC = e.MAC.String()
+	}
+	if e.Protocol != nil {
+		v.Protocol = ProtocolName(*e.Protocol)
+	}
+	if typ, code, ok := e.ICMP(); ok {
+		v.Port = nil
+		if uint16(*e.Protocol) == ProtocolICMP {
+			v.ICMP = ICMPTypeName(typ, code)
+		} else {
+			v.ICMP = ICMPv6TypeName(typ, code)
+		}
+	}
+	return v
+}
+
+func (e *Entry) fromJSON(v *entryJSON) (err error) {
+	*e = Entry{
+		Name:     v.Name,
+		CIDR:     v.CIDR,
+		CIDR2:    v.CIDR2,
+		Port:     v.Port,
+		PortTo:   v.PortTo,
+		IFace:    v.IFace,
+		Mark:     v.Mark,
+		NoMatch:  v.NoMatch,
+		Timeout:  v.Timeout,
+		Packets:  v.Packets,
+		Bytes:    v.Bytes,
+		Comment:  v.Comment,
+		SkbMark:  v.SkbMark,
+		SkbMask:  v.SkbMask,
+		SkbPrio:  v.SkbPrio,
+		SkbQueue: v.SkbQueue,
+		Replace:  v.Replace,
+	}
+	if v.Timeout != nil {
+		e.TTL = secondsPtr(*v.Timeout)
+	}
+	if e.IP, err = stringToIP(v.IP, "ip"); err != nil {
+		return err
+	}
+	if e.IPTo, err = stringToIP(v.IPTo, "ip_to"); err != nil {
+		return err
+	}
+	if e.IP2, err = stringToIP(v.IP2, "ip2"); err != nil {
+		return err
+	}
+	if v.MAC != "" {
+		if e.MAC, err = net.ParseMAC(v.MAC); err != nil {
+			return err
+		}
+	}
+	if v.Protocol != "" {
+		proto, err := ParseProtocol(v.Protocol)
+		if err != nil {
+			return err
+		}
+		e.Protocol = &proto
+	}
+	if v.ICMP != "" {
+		if e.Protocol == nil {
+			return fmt.Errorf("icmp type %q given without protocol", v.ICMP)
+		}
+		switch uint16(*e.Protocol) {
+		case ProtocolICMP:
+			typ, code, err := ParseICMPType(v.ICMP)
+			if err != nil {
+				return err
+			}
+			e.SetICMP(typ, code)
+		case ProtocolICMPv6:
+			typ, code, err := ParseICMPv6Type(v.ICMP)
+			if err != nil {
+				return err
+			}
+			e.SetICMPv6(typ, code)
+		default:
+			return fmt.Errorf("icmp type %q given for protocol %s", v.ICMP, v.Protocol)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.toJSON())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var v entryJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return e.fromJSON(&v)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface of gopkg.in/yaml.
+func (e Entry) MarshalYAML() (interface{}, error) {
+	return e.toJSON(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface of gopkg.in/yaml.
+func (e *Entry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v entryJSON
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	return e.fromJSON(&v)
+}
+
+func (s *Sets) toJSON() setsJSON {
+	v := setsJSON{
+		Name:         s.SetName,
+		Type:         s.TypeName,
+		Revision:     s.Revision,
+		Comment:      s.Comment,
+		HashSize:     s.HashSize,
+		MaxElements:  s.MaxElements,
+		Size:         s.Size,
+		IPFrom:       ipToString(s.IPFrom),
+		IPTo:         ipToString(s.IPTo),
+		PortFrom:     s.PortFrom,
+		PortTo:       s.PortTo,
+		NetMask:      s.NetMask,
+		BitMask:      ipToString(s.BitMask),
+		MarkMask:     s.MarkMask,
+		Timeout:      s.Timeout,
+		Flags:        cadtFlagsToNames(s.CadtFlags),
+		References:   s.References,
+		SizeInMemory: s.SizeInMemory,
+		NumEntries:   s.NumEntries,
+		Entries:      s.Entries,
+	}
+	if s.Timeout == nil && s.TTL != nil {
+		v.Timeout = Uint32Ptr(TimeoutSeconds(*s.TTL))
+	}
+	if s.Family != FamilyUnspec {
+		v.Family = FamilyName(s.Family)
+	}
+	if v.Entries == nil {
+		v.Entries = []Entry{}
+	}
+	return v
+}
+
+func (s *Sets) fromJSON(v *setsJSON) (err error) {
+	*s = Sets{
+		SetName:      v.Name,
+		TypeName:     v.Type,
+		Revision:     v.Revision,
+		Comment:      v.Comment,
+		HashSize:     v.HashSize,
+		MaxElements:  v.MaxElements,
+		Size:         v.Size,
+		PortFrom:     v.PortFrom,
+		PortTo:       v.PortTo,
+		NetMask:      v.NetMask,
+		MarkMask:     v.MarkMask,
+		Timeout:      v.Timeout,
+		References:   v.References,
+		SizeInMemory: v.SizeInMemory,
+		NumEntries:   v.NumEntries,
+		Entries:      v.Entries,
+	}
+	if v.Timeout != nil {
+		s.TTL = secondsPtr(*v.Timeout)
+	}
+	if s.Family, err = familyFromString(v.Family); err != nil {
+		return err
+	}
+	if s.CadtFlags, err = namesToCadtFlags(v.Flags); err != nil {
+		return err
+	}
+	if s.IPFrom, err = stringToIP(v.IPFrom, "ip_from"); err != nil {
+		return err
+	}
+	if s.IPTo, err = stringToIP(v.IPTo, "ip_to"); err != nil {
+		return err
+	}
+	if s.BitMask, err = stringToIP(v.BitMask, "bitmask"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Sets) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.toJSON())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Sets) UnmarshalJSON(data []byte) error {
+	var v setsJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return s.fromJSON(&v)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface of gopkg.in/yaml.
+func (s Sets) MarshalYAML() (interface{}, error) {
+	return s.toJSON(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface of gopkg.in/yaml.
+func (s *Sets) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v setsJSON
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	return s.fromJSON(&v)
+}
+
+func (opts *CreateOptions) toJSON() createOptionsJSON {
+	v := createOptionsJSON{
+		Revision:    opts.Revision,
+		Size:        opts.Size,
+		MaxElements: opts.MaxElements,
+		Timeout:     opts.timeout(),
+		Flags:       cadtFlagsToNames(opts.CadtFlags()),
+		IPFrom:      ipToString(opts.IPFrom),
+		IPTo:        ipToString(opts.IPTo),
+		NetMask:     opts.NetMask,
+		BitMask:     ipToString(opts.BitMask),
+		MarkMask:    opts.MarkMask,
+		PortFrom:    opts.PortFrom,
+		PortTo:      opts.PortTo,
+		Replace:     opts.Replace,
+	}
+	if opts.Family != FamilyUnspec {
+		v.Family = FamilyName(opts.Family)
+	}
+	return v
+}
+
+func (opts *CreateOptions) fromJSON(v *createOptionsJSON) (err error) {
+	*opts = CreateOptions{
+		Revision:    v.Revision,
+		Size:        v.Size,
+		MaxElements: v.MaxElements,
+		Timeout:     v.Timeout,
+		NetMask:     v.NetMask,
+		MarkMask:    v.MarkMask,
+		PortFrom:    v.PortFrom,
+		PortTo:      v.PortTo,
+		Replace:     v.Replace,
+	}
+	if v.Timeout != 0 {
+		opts.TTL = time.Duration(v.Timeout) * time.Second
+	}
+	if opts.Family, err = familyFromString(v.Family); err != nil {
+		return err
+	}
+	flags, err := namesToCadtFlags(v.Flags)
+	if err != nil {
+		return err
+	}
+	opts.Counters = flags&IPSET_FLAG_WITH_COUNTERS != 0
+	opts.Comments = flags&IPSET_FLAG_WITH_COMMENT != 0
+	opts.Skbinfo = flags&IPSET_FLAG_WITH_SKBINFO != 0
+	opts.ForceAdd = flags&IPSET_FLAG_WITH_FORCEADD != 0
+	if opts.IPFrom, err = stringToIP(v.IPFrom, "ip_from"); err != nil {
+		return err
+	}
+	if opts.IPTo, err = stringToIP(v.IPTo, "ip_to"); err != nil {
+		return err
+	}
+	if opts.BitMask, err = stringToIP(v.BitMask, "bitmask"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (opts CreateOptions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(opts.toJSON())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (opts *CreateOptions) UnmarshalJSON(data []byte) error {
+	var v createOptionsJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return opts.fromJSON(&v)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface of gopkg.in/yaml.
+func (opts CreateOptions) MarshalYAML() (interface{}, error) {
+	return opts.toJSON(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface of gopkg.in/yaml.
+func (opts *CreateOptions) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v createOptionsJSON
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	return opts.fromJSON(&v)
+}
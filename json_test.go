@@ -0,0 +1,123 @@
+package ipset
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetsJSON(t *testing.T) {
+	timeout := uint32(300)
+	packets := uint64(42)
+	set := Sets{
+		SetName:     "foo",
+		TypeName:    TypeHashIPPort,
+		Revision:    5,
+		Family:      FamilyIPV4,
+		HashSize:    1024,
+		MaxElements: 65536,
+		Timeout:     &timeout,
+		CadtFlags:   IPSET_FLAG_WITH_COUNTERS | IPSET_FLAG_WITH_COMMENT,
+		NumEntries:  2,
+		Entries: []Entry{
+			{IP: net.ParseIP("10.0.0.1").To4(), Protocol: Uint8Ptr(uint8(ProtocolUDP)), Port: Uint16Ptr(53), Packets: &packets, Comment: "dns"},
+			{IP: net.ParseIP("2001:db8::1"), Protocol: Uint8Ptr(uint8(ProtocolICMPv6)), Port: Uint16Ptr(ICMPTypeCode(128, 0))},
+		},
+	}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"ip":"10.0.0.1"`, `"type":"hash:ip,port"`, `"family":"inet"`, `"flags":["counters","comment"]`, `"protocol":"udp"`, `"icmp":"echo-request"`} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("expected %s in %s", s, data)
+		}
+	}
+
+	var decoded Sets
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.CadtFlags != set.CadtFlags || decoded.Family != set.Family || *decoded.Timeout != timeout {
+		t.Errorf("unexpected header: %+v", decoded)
+	}
+	if len(decoded.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(decoded.Entries))
+	}
+	for i := range set.Entries {
+		expected, actual := set.Entries[i].Format(set.TypeName), decoded.Entries[i].Format(set.TypeName)
+		if expected != actual {
+			t.Errorf("expected entry %q, got %q", expected, actual)
+		}
+	}
+
+	var entry Entry
+	entry.SetTTL(2 * time.Minute)
+	entry.Timeout = nil
+	if data, err = json.Marshal(entry); err != nil || string(data) != `{"timeout":120}` {
+		t.Errorf("unexpected entry %s: %v", data, err)
+	}
+	if err := json.Unmarshal(data, &entry); err != nil || entry.TTL == nil || *entry.TTL != 2*time.Minute {
+		t.Errorf("unexpected entry %+v: %v", entry, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"name":"foo","flags":["bogus"]}`), &decoded); err == nil {
+		t.Error("expected unknown flag to be rejected")
+	}
+	if err := json.Unmarshal([]byte(`{"ip":"10.0.0.300"}`), &Entry{}); err == nil {
+		t.Error("expected invalid ip to be rejected")
+	}
+}
+
+func TestCreateOptionsJSONYAML(t *testing.T) {
+	opts := CreateOptions{
+		Family:      FamilyIPV6,
+		Size:        2048,
+		MaxElements: 1000,
+		Comments:    true,
+		Skbinfo:     true,
+	}
+	opts.SetTTL(time.Minute)
+
+	data, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"family":"inet6","size":2048,"maxelem":1000,"timeout":60,"flags":["comment","skbinfo"]}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+
+	var decoded CreateOptions
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(opts, decoded) {
+		t.Errorf("expected %+v, got %+v", opts, decoded)
+	}
+
+	// a YAML library hands the value returned by MarshalYAML to its encoder
+	// and calls UnmarshalYAML with a decoder for the same document
+	v, err := opts.MarshalYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded = CreateOptions{}
+	err = decoded.UnmarshalYAML(func(out interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, out)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(opts, decoded) {
+		t.Errorf("expected %+v, got %+v", opts, decoded)
+	}
+}
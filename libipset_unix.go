@@ -5,8 +5,11 @@
 )
 
 const (
-	/* The protocol version */
+	/* The protocol version, used when it cannot be negotiated */
 	IPSET_PROTOCOL = 6
+	/* The oldest and newest protocol versions we speak */
+	IPSET_PROTOCOL_MIN = 6
+	IPSET_PROTOCOL_MAX = 7
 
 	/* The max length of strings including NUL: set and type identifiers */
 	IPSET_MAXNAMELEN = 32
@@ -30,6 +33,9 @@
 	IPSET_CMD_TEST     /* 11: Test an element in a set */
 	IPSET_CMD_HEADER   /* 12: Get set header data only */
 	IPSET_CMD_TYPE     /* 13: Get set type */
+
+	IPSET_CMD_GET_BYNAME  /* 14: Get set index by name */
+	IPSET_CMD_GET_BYINDEX /* 15: Get set name by index */
 )
 
 /* Attributes at command level */
@@ -45,6 +51,7 @@
 	IPSET_ATTR_ADT          /* 8: Multiple data containers */
 	IPSET_ATTR_LINENO       /* 9: Restore lineno */
 	IPSET_ATTR_PROTOCOL_MIN /* 10: Minimal supported version number */
+	IPSET_ATTR_INDEX        /* 11: Kernel index of set */
 
 	IPSET_ATTR_SETNAME2     = IPSET_ATTR_TYPENAME     /* Setname at rename/swap */
 	IPSET_ATTR_REVISION_MIN = IPSET_ATTR_PROTOCOL_MIN /* type rev min */
@@ -65,25 +72,40 @@
 	IPSET_ATTR_CADT_LINENO = IPSET_ATTR_LINENO /* 9 */
 	IPSET_ATTR_MARK        = 10
 	IPSET_ATTR_MARKMASK    = 11
+	IPSET_ATTR_BITMASK     = 12
 
 	/* Reserve empty slots */
 	IPSET_ATTR_CADT_MAX = 16
+)
 
-	/* Create-only specific attributes */
-	IPSET_ATTR_GC = 3 + iota
-	IPSET_ATTR_HASHSIZE
-	IPSET_ATTR_MAXELEM
-	IPSET_ATTR_NETMASK
-	IPSET_ATTR_PROBES
-	IPSET_ATTR_RESIZE
-	IPSET_ATTR_SIZE
+/* Create-only specific attributes */
+const (
+	IPSET_ATTR_GC       = 17
+	IPSET_ATTR_HASHSIZE = 18
+	IPSET_ATTR_MAXELEM  = 19
+	IPSET_ATTR_NETMASK  = 20
+	IPSET_ATTR_PROBES   = 21
+	IPSET_ATTR_RESIZE   = 22
+	IPSET_ATTR_SIZE     = 23
 
 	/* Kernel-only */
-	IPSET_ATTR_ELEMENTS
-	IPSET_ATTR_REFERENCES
-	IPSET_ATTR_MEMSIZE
+	IPSET_ATTR_ELEMENTS   = 24
+	IPSET_ATTR_REFERENCES = 25
+	IPSET_ATTR_MEMSIZE    = 26
+
+	SET_ATTR_CREATE_MAX = 27
+)
 
-	SET_ATTR_CREATE_MAX
+/* Create-only attributes renamed by newer kernels */
+const (
+	IPSET_ATTR_INITVAL    = IPSET_ATTR_GC     /* hash initial value */
+	IPSET_ATTR_BUCKETSIZE = IPSET_ATTR_PROBES /* max elements in a hash bucket */
+)
+
+/* IP specific attributes */
+const (
+	IPSET_ATTR_IPADDR_IPV4 = 1
+	IPSET_ATTR_IPADDR_IPV6 = 2
 )
 
 /* ADT specific attributes */
@@ -140,7 +162,9 @@ func GetCommandFlags(cmd int) int {
 		return unix.NLM_F_REQUEST | unix.NLM_F_ACK
 	case IPSET_CMD_HEADER,
 		IPSET_CMD_TYPE,
-		IPSET_CMD_PROTOCOL:
+		IPSET_CMD_PROTOCOL,
+		IPSET_CMD_GET_BYNAME,
+		IPSET_CMD_GET_BYINDEX:
 		return unix.NLM_F_REQUEST
 	default:
 		return 0
@@ -0,0 +1,207 @@
+// Package metrics exports the state of ipsets in the Prometheus text
+// exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/lrh3321/ipset-go"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Lister lists all sets along with their entries. *ipset.Handle implements it.
+type Lister interface {
+	ListAll() ([]ipset.Sets, error)
+}
+
+// Options controls which series are exported.
+type Options struct {
+	// Namespace prefixes all metric names. Defaults to "ipset".
+	Namespace string
+	// Sets is an allow-list of set names to export. Empty exports all sets.
+	Sets []string
+	// EntrySets is an allow-list of set names whose entries get their own
+	// packets/bytes series. Sets not listed only export the sums over their
+	// entries, as gauges since entries expire or get deleted.
+	EntrySets []string
+	// TopEntries limits the per-entry series of a set to the entries with the
+	// most bytes. Zero exports every entry.
+	TopEntries int
+}
+
+// Handler is an http.Handler serving the metrics of all sets returned by its
+// Lister.
+type Handler struct {
+	lister Lister
+	opts   Options
+}
+
+// NewHandler returns a Handler exporting the sets returned by lister.
+func NewHandler(lister Lister, opts Options) *Handler {
+	if opts.Namespace == "" {
+		opts.Namespace = "ipset"
+	}
+	return &Handler{lister: lister, opts: opts}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sets, err := h.lister.ListAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	h.write(w, sets)
+}
+
+// WriteTo lists the sets and writes their metrics to w.
+func (h *Handler) WriteTo(w io.Writer) (int64, error) {
+	sets, err := h.lister.ListAll()
+	if err != nil {
+		return 0, err
+	}
+	return h.write(w, sets)
+}
+
+type sample struct {
+	labels [][2]string
+	value  uint64
+}
+
+type family struct {
+	name, help, typ string
+	samples         []sample
+}
+
+func (h *Handler) write(w io.Writer, sets []ipset.Sets) (int64, error) {
+	ns := h.opts.Namespace
+	families := []*family{
+		{name: ns + "_entries", help: "Number of entries in the set.", typ: "gauge"},
+		{name: ns + "_memory_bytes", help: "Size of the set in kernel memory.", typ: "gauge"},
+		{name: ns + "_references", help: "Number of references to the set.", typ: "gauge"},
+		{name: ns + "_max_entries", help: "Maximal number of entries of a hash set.", typ: "gauge"},
+		{name: ns + "_packets", help: "Packets matched by the current entries of the set.", typ: "gauge"},
+		{name: ns + "_bytes", help: "Bytes matched by the current entries of the set.", typ: "gauge"},
+		{name: ns + "_entry_packets_total", help: "Packets matched by an entry.", typ: "counter"},
+		{name: ns + "_entry_bytes_total", help: "Bytes matched by an entry.", typ: "counter"},
+	}
+	entries, memory, references, maxEntries := families[0], families[1], families[2], families[3]
+	packets, bytes, entryPackets, entryBytes := families[4], families[5], families[6], families[7]
+
+	for i := range sets {
+		s := &sets[i]
+		if !allowed(h.opts.Sets, s.SetName) {
+			continue
+		}
+
+		labels := [][2]string{{"set", s.SetName}, {"type", s.TypeName}}
+		entries.add(labels, uint64(s.NumEntries))
+		memory.add(labels, uint64(s.SizeInMemory))
+		references.add(labels, uint64(s.References))
+		if ipset.TypeName(s.TypeName).Method() == "hash" {
+			maxEntries.add(labels, uint64(s.MaxElements))
+		}
+
+		if s.CadtFlags&ipset.IPSET_FLAG_WITH_COUNTERS == 0 {
+			continue
+		}
+		var p, b uint64
+		for j := range s.Entries {
+			p += value(s.Entries[j].Packets)
+			b += value(s.Entries[j].Bytes)
+		}
+		packets.add(labels[:1], p)
+		bytes.add(labels[:1], b)
+
+		if len(h.opts.EntrySets) == 0 || !allowed(h.opts.EntrySets, s.SetName) {
+			continue
+		}
+		for _, e := range h.topEntries(s.Entries) {
+			entryLabels := [][2]string{{"set", s.SetName}, {"entry", e.Elem(s.TypeName)}}
+			entryPackets.add(entryLabels, value(e.Packets))
+			entryBytes.add(entryLabels, value(e.Bytes))
+		}
+	}
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.write(cw)
+	}
+	if err := cw.w.Flush(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, nil
+}
+
+// topEntries returns the TopEntries entries with the most bytes, in their
+// original order when there is no limit.
+func (h *Handler) topEntries(entries []ipset.Entry) []ipset.Entry {
+	if h.opts.TopEntries <= 0 || len(entries) <= h.opts.TopEntries {
+		return entries
+	}
+	sorted := make([]ipset.Entry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return value(sorted[i].Bytes) > value(sorted[j].Bytes)
+	})
+	return sorted[:h.opts.TopEntries]
+}
+
+func (f *family) add(labels [][2]string, v uint64) {
+	f.samples = append(f.samples, sample{labels: labels, value: v})
+}
+
+func (f *family) write(w *countingWriter) {
+	if len(f.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	for _, s := range f.samples {
+		pairs := make([]string, len(s.labels))
+		for i, l := range s.labels {
+			pairs[i] = l[0] + `="` + labelEscaper.Replace(l[1]) + `"`
+		}
+		fmt.Fprintf(w, "%s{%s} %d\n", f.name, strings.Join(pairs, ","), s.value)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func allowed(list []string, name string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, n := range list {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func value(v *uint64) uint64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lrh3321/ipset-go"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// dumpLister replays a captured `ipset list -output xml` dump.
+type dumpLister struct {
+	path string
+}
+
+func (l dumpLister) ListAll() ([]ipset.Sets, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ipset.DecodeXML(f)
+}
+
+type errLister struct{}
+
+func (errLister) ListAll() ([]ipset.Sets, error) {
+	return nil, errors.New("no permission")
+}
+
+func TestHandler(t *testing.T) {
+	lister := dumpLister{path: "../testdata/ipset_list.xml"}
+
+	for _, tc := range []struct {
+		golden string
+		opts   Options
+	}{
+		{"testdata/all.txt", Options{}},
+		{"testdata/top.txt", Options{Namespace: "fw", Sets: []string{"web", "ports"}, EntrySets: []string{"web"}, TopEntries: 1}},
+	} {
+		var buf bytes.Buffer
+		if _, err := NewHandler(lister, tc.opts).WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if *update {
+			if err := ioutil.WriteFile(tc.golden, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected, err := ioutil.ReadFile(tc.golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Errorf("output differs from %s:\n%s", tc.golden, buf.String())
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHandler(dumpLister{path: "../testdata/ipset_list.xml"}, Options{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != ContentType {
+		t.Errorf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `ipset_entries{set="web",type="hash:ip,port"} 2`) {
+		t.Errorf("unexpected body:\n%s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	NewHandler(errLister{}, Options{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,170 @@
+package ipset
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ModuleName returns the kernel module implementing a set type, e.g.
+// "ip_set_hash_netportnet" for hash:net,port,net.
+func ModuleName(typename string) string {
+	return "ip_set_" + strings.NewReplacer(":", "_", ",", "").Replace(typename)
+}
+
+// ModuleLoader inspects and loads the kernel modules of set types.
+type ModuleLoader struct {
+	ProcModules string // defaults to /proc/modules
+	ModulesDir  string // defaults to /lib/modules/<kernel release>
+	Modprobe    string // defaults to modprobe
+}
+
+// ModuleError explains why a set type is not available.
+type ModuleError struct {
+	TypeName  string
+	Module    string
+	Loaded    bool // module is loaded or built into the kernel
+	Installed bool // module is installed in ModulesDir
+	Dir       string
+	Err       error
+}
+
+func (e *ModuleError) Error() string {
+	msg := fmt.Sprintf("set type %s is provided by kernel module %s", e.TypeName, e.Module)
+	switch {
+	case e.Loaded:
+		msg += ", which is loaded"
+	case e.Installed:
+		msg += fmt.Sprintf(", which is not loaded (try `modprobe %s`)", e.Module)
+	default:
+		msg += fmt.Sprintf(", which is not installed in %s", e.Dir)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ModuleError) Unwrap() error {
+	return e.Err
+}
+
+func (l *ModuleLoader) procModules() string {
+	if l.ProcModules != "" {
+		return l.ProcModules
+	}
+	return "/proc/modules"
+}
+
+func (l *ModuleLoader) modulesDir() string {
+	if l.ModulesDir != "" {
+		return l.ModulesDir
+	}
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return "/lib/modules"
+	}
+	return filepath.Join("/lib/modules", unix.ByteSliceToString(uts.Release[:]))
+}
+
+// Loaded reports whether module is loaded or built into the kernel.
+func (l *ModuleLoader) Loaded(module string) (bool, error) {
+	found, err := scanLines(l.procModules(), func(line string) bool {
+		return strings.SplitN(line, " ", 2)[0] == module
+	})
+	if found || err != nil {
+		return found, err
+	}
+
+	found, err = scanLines(filepath.Join(l.modulesDir(), "modules.builtin"), func(line string) bool {
+		return moduleFileName(line) == module
+	})
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return found, err
+}
+
+// Installed reports whether module is installed in the modules directory.
+func (l *ModuleLoader) Installed(module string) (bool, error) {
+	found, err := scanLines(filepath.Join(l.modulesDir(), "modules.dep"), func(line string) bool {
+		return moduleFileName(strings.SplitN(line, ":", 2)[0]) == module
+	})
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return found, err
+}
+
+// Explain turns an ErrInvalidType returned for typename into a *ModuleError
+// telling whether its module is missing or just not loaded. Other errors are
+// returned unchanged.
+func (l *ModuleLoader) Explain(typename string, err error) error {
+	if !errors.Is(err, ErrInvalidType) {
+		return err
+	}
+
+	e := &ModuleError{TypeName: typename, Module: ModuleName(typename), Dir: l.modulesDir(), Err: err}
+	var lerr error
+	if e.Loaded, lerr = l.Loaded(e.Module); lerr != nil {
+		return err
+	}
+	if !e.Loaded {
+		e.Installed, _ = l.Installed(e.Module)
+	}
+	return e
+}
+
+// Load loads the module of typename with modprobe, unless it is loaded.
+func (l *ModuleLoader) Load(typename string) error {
+	module := ModuleName(typename)
+	if loaded, err := l.Loaded(module); err == nil && loaded {
+		return nil
+	}
+
+	modprobe := l.Modprobe
+	if modprobe == "" {
+		modprobe = "modprobe"
+	}
+	out, err := exec.Command(modprobe, module).CombinedOutput()
+	if err != nil {
+		installed, _ := l.Installed(module)
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return &ModuleError{TypeName: typename, Module: module, Installed: installed, Dir: l.modulesDir(), Err: err}
+	}
+	return nil
+}
+
+// moduleFileName returns the module name of a path like
+// "kernel/net/netfilter/ipset/ip_set_hash_ip.ko.xz".
+func moduleFileName(path string) string {
+	name := filepath.Base(strings.TrimSpace(path))
+	if idx := strings.Index(name, ".ko"); idx >= 0 {
+		name = name[:idx]
+	}
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+func scanLines(path string, match func(line string) bool) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if match(scanner.Text()) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
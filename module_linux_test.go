@@ -0,0 +1,115 @@
+package ipset
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestModuleName(t *testing.T) {
+	for typename, expected := range map[string]string{
+		TypeHashNetPortNet: "ip_set_hash_netportnet",
+		TypeBitmapIP:       "ip_set_bitmap_ip",
+		TypeListSet:        "ip_set_list_set",
+	} {
+		if actual := ModuleName(typename); actual != expected {
+			t.Errorf("ModuleName(%s): expected %s, got %s", typename, expected, actual)
+		}
+	}
+}
+
+func TestModuleLoader(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	l := &ModuleLoader{
+		ProcModules: write("modules", "ip_set_hash_ip 45056 0 - Live 0x0000000000000000\nip_set 53248 1 ip_set_hash_ip, Live 0x0000000000000000\n"),
+		ModulesDir:  dir,
+		Modprobe:    "false",
+	}
+	write("modules.builtin", "kernel/net/netfilter/ipset/ip_set_bitmap_ip.ko\n")
+	write("modules.dep", "kernel/net/netfilter/ipset/ip_set_hash_netnet.ko.xz: kernel/net/netfilter/ipset/ip_set.ko.xz\n")
+
+	for _, tc := range []struct {
+		typename  string
+		loaded    bool
+		installed bool
+		message   string
+	}{
+		{TypeHashIP, true, false, "which is loaded"},
+		{TypeBitmapIP, true, false, "which is loaded"},
+		{TypeHashNetNet, false, true, "try `modprobe ip_set_hash_netnet`"},
+		{TypeHashNetPortNet, false, false, "not installed in " + dir},
+	} {
+		err := l.Explain(tc.typename, ErrInvalidType)
+		var merr *ModuleError
+		if !errors.As(err, &merr) {
+			t.Fatalf("%s: expected *ModuleError, got %v", tc.typename, err)
+		}
+		if merr.Loaded != tc.loaded || merr.Installed != tc.installed {
+			t.Errorf("%s: unexpected %+v", tc.typename, merr)
+		}
+		if !strings.Contains(err.Error(), tc.message) || !errors.Is(err, ErrInvalidType) {
+			t.Errorf("%s: unexpected message %q", tc.typename, err)
+		}
+	}
+
+	if err := l.Explain(TypeHashIP, ErrSetNotExist); err != ErrSetNotExist {
+		t.Errorf("expected unrelated errors to be unchanged, got %v", err)
+	}
+
+	if err := l.Load(TypeHashIP); err != nil {
+		t.Errorf("expected loaded module not to run modprobe, got %v", err)
+	}
+	var merr *ModuleError
+	if err := l.Load(TypeHashNetNet); !errors.As(err, &merr) || !merr.Installed {
+		t.Errorf("expected failing modprobe to return *ModuleError, got %v", err)
+	}
+	l.Modprobe = "true"
+	if err := l.Load(TypeHashNetNet); err != nil {
+		t.Errorf("expected modprobe to succeed, got %v", err)
+	}
+
+	os.Remove(l.ProcModules)
+	if err := l.Explain(TypeHashIP, ErrInvalidType); err != ErrInvalidType {
+		t.Errorf("expected the original error without /proc/modules, got %v", err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	skipUnlessRoot(t)
+
+	h, err := NewHandle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	c, err := h.Capabilities()
+	if err != nil {
+		t.Skip("ipset is not available: ", err)
+	}
+	if c.Protocol < c.ProtocolMin || len(c.Types) != len(typeRevisionsMap) {
+		t.Errorf("unexpected capabilities %+v", c)
+	}
+	for _, typ := range c.Types {
+		if typ.Available && (typ.MaxRevision < typ.MinRevision || !c.Supports(typ.TypeName, typ.MaxRevision)) {
+			t.Errorf("unexpected type %+v", typ)
+		}
+		if !typ.Available && !errors.Is(typ.Err, ErrInvalidType) {
+			t.Errorf("unexpected error for %s: %v", typ.TypeName, typ.Err)
+		}
+	}
+	if c.Supports("hash:bogus", 0) {
+		t.Error("expected unknown type not to be supported")
+	}
+}
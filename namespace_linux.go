@@ -0,0 +1,239 @@
+package ipset
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/vishvananda/netns"
+)
+
+// NamedNamespaceDir is where `ip netns` mounts named network namespaces.
+var NamedNamespaceDir = "/var/run/netns"
+
+// NamespaceManager opens and caches one Handle per network namespace.
+// Namespaces are keyed by the path, "pid:<pid>" or name they were opened by.
+// Keys referring to the same namespace share a Handle.
+type NamespaceManager struct {
+	mu      sync.Mutex
+	handles map[string]*Handle // by key
+	unique  map[string]*Handle // by netns.NsHandle.UniqueId
+}
+
+// NewNamespaceManager returns an empty NamespaceManager.
+func NewNamespaceManager() *NamespaceManager {
+	return &NamespaceManager{
+		handles: make(map[string]*Handle),
+		unique:  make(map[string]*Handle),
+	}
+}
+
+// ByPath returns the handle of the namespace bind-mounted at path, e.g.
+// "/proc/1/ns/net".
+func (m *NamespaceManager) ByPath(path string) (*Handle, error) {
+	return m.open(path, func() (netns.NsHandle, error) { return netns.GetFromPath(path) })
+}
+
+// ByPid returns the handle of the namespace of process pid.
+func (m *NamespaceManager) ByPid(pid int) (*Handle, error) {
+	return m.open("pid:"+strconv.Itoa(pid), func() (netns.NsHandle, error) { return netns.GetFromPid(pid) })
+}
+
+// ByName returns the handle of a namespace created by `ip netns add name`.
+func (m *NamespaceManager) ByName(name string) (*Handle, error) {
+	return m.open(name, func() (netns.NsHandle, error) {
+		return netns.GetFromPath(filepath.Join(NamedNamespaceDir, name))
+	})
+}
+
+func (m *NamespaceManager) open(key string, get func() (netns.NsHandle, error)) (*Handle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if h, ok := m.handles[key]; ok {
+		return h, nil
+	}
+
+	ns, err := get()
+	if err != nil {
+		return nil, fmt.Errorf("namespace %s: %w", key, err)
+	}
+	defer ns.Close()
+
+	id := ns.UniqueId()
+	h, ok := m.unique[id]
+	if !ok {
+		if h, err = NewHandleAt(ns); err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", key, err)
+		}
+		m.unique[id] = h
+	}
+	m.handles[key] = h
+	return h, nil
+}
+
+// Discover opens every named namespace and every namespace a process runs
+// in, and returns the keys of the namespaces found. A namespace both named
+// and used by processes is only keyed by its name.
+func (m *NamespaceManager) Discover() ([]string, error) {
+	var keys []string
+	seen := make(map[string]bool)
+
+	add := func(key string, get func() (netns.NsHandle, error)) {
+		ns, err := get()
+		if err != nil {
+			// processes exit, namespaces get deleted
+			return
+		}
+		id := ns.UniqueId()
+		ns.Close()
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		keys = append(keys, key)
+	}
+
+	if files, err := ioutil.ReadDir(NamedNamespaceDir); err == nil {
+		for _, f := range files {
+			path := filepath.Join(NamedNamespaceDir, f.Name())
+			add(f.Name(), func() (netns.NsHandle, error) { return netns.GetFromPath(path) })
+		}
+	}
+
+	procs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(procs, func(i, j int) bool { return pidOf(procs[i]) < pidOf(procs[j]) })
+	for _, proc := range procs {
+		pid := pidOf(proc)
+		add("pid:"+strconv.Itoa(pid), func() (netns.NsHandle, error) { return netns.GetFromPid(pid) })
+	}
+
+	for i := 0; i < len(keys); i++ {
+		var err error
+		if pid, ok := pidKey(keys[i]); ok {
+			_, err = m.ByPid(pid)
+		} else {
+			_, err = m.ByName(keys[i])
+		}
+		if err != nil {
+			// gone since it was found
+			keys = append(keys[:i], keys[i+1:]...)
+			i--
+		}
+	}
+	return keys, nil
+}
+
+func pidOf(proc string) int {
+	pid, _ := strconv.Atoi(filepath.Base(proc))
+	return pid
+}
+
+func pidKey(key string) (int, bool) {
+	if len(key) < 5 || key[:4] != "pid:" {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(key[4:])
+	return pid, err == nil
+}
+
+// Namespaces returns the keys of the cached namespaces, sorted.
+func (m *NamespaceManager) Namespaces() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.handles))
+	for k := range m.handles {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Each calls fn concurrently with the handle of every cached namespace and
+// returns the errors keyed by namespace.
+func (m *NamespaceManager) Each(fn func(key string, h *Handle) error) map[string]error {
+	m.mu.Lock()
+	handles := make(map[string]*Handle, len(m.handles))
+	for k, h := range m.handles {
+		handles[k] = h
+	}
+	m.mu.Unlock()
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = make(map[string]error)
+	)
+	for k, h := range handles {
+		wg.Add(1)
+		go func(k string, h *Handle) {
+			defer wg.Done()
+			if err := fn(k, h); err != nil {
+				mu.Lock()
+				errs[k] = err
+				mu.Unlock()
+			}
+		}(k, h)
+	}
+	wg.Wait()
+	return errs
+}
+
+// ListAll dumps all ipsets of every cached namespace.
+func (m *NamespaceManager) ListAll() (map[string][]Sets, map[string]error) {
+	var mu sync.Mutex
+	result := make(map[string][]Sets)
+	errs := m.Each(func(key string, h *Handle) error {
+		sets, err := h.ListAll()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		result[key] = sets
+		mu.Unlock()
+		return nil
+	})
+	return result, errs
+}
+
+// Forget closes the handle of a namespace unless another key shares it.
+func (m *NamespaceManager) Forget(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.handles[key]
+	if !ok {
+		return
+	}
+	delete(m.handles, key)
+	for _, other := range m.handles {
+		if other == h {
+			return
+		}
+	}
+	for id, other := range m.unique {
+		if other == h {
+			delete(m.unique, id)
+		}
+	}
+	h.Close()
+}
+
+// Close closes all cached handles.
+func (m *NamespaceManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, h := range m.unique {
+		h.Close()
+	}
+	m.handles = make(map[string]*Handle)
+	m.unique = make(map[string]*Handle)
+}
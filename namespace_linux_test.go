@@ -0,0 +1,112 @@
+package ipset
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/vishvananda/netns"
+)
+
+func TestNamespaceManager(t *testing.T) {
+	skipUnlessRoot(t)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origNS, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origNS.Close()
+
+	ns, err := netns.New()
+	if err != nil {
+		t.Skip("creating network namespaces is not permitted: ", err)
+	}
+	defer ns.Close()
+	nsPath := fmt.Sprintf("/proc/self/fd/%d", int(ns))
+	if err := netns.Set(origNS); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewNamespaceManager()
+	defer m.Close()
+
+	inner, err := m.ByPath(nsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := m.ByPid(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same, err := m.ByPath("/proc/self/ns/net"); err != nil || same != host {
+		t.Errorf("expected the handle of the same namespace to be shared, got %v", err)
+	}
+	if again, _ := m.ByPath(nsPath); again != inner {
+		t.Error("expected the handle to be cached")
+	}
+	if _, err := m.ByName("ipset-go-does-not-exist"); err == nil {
+		t.Error("expected missing named namespace to fail")
+	}
+
+	setname := "nsmanager-test"
+	if err := inner.Create(setname, TypeHashIP, CreateOptions{}); err != nil {
+		t.Skip("ipset is not available: ", err)
+	}
+	defer inner.Destroy(setname)
+
+	all, errs := m.ListAll()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 keys, got %v", m.Namespaces())
+	}
+	found := func(sets []Sets) bool {
+		for _, s := range sets {
+			if s.SetName == setname {
+				return true
+			}
+		}
+		return false
+	}
+	if !found(all[nsPath]) {
+		t.Errorf("expected %s in namespace %s", setname, nsPath)
+	}
+	if found(all[fmt.Sprintf("pid:%d", os.Getpid())]) {
+		t.Errorf("expected %s not to leak into the host namespace", setname)
+	}
+
+	m.Forget("/proc/self/ns/net")
+	if host.socket == nil {
+		t.Error("expected shared handle to stay open")
+	}
+	m.Forget(fmt.Sprintf("pid:%d", os.Getpid()))
+	if host.socket != nil {
+		t.Error("expected handle to be closed")
+	}
+}
+
+func TestNamespaceManagerDiscover(t *testing.T) {
+	skipUnlessRoot(t)
+
+	m := NewNamespaceManager()
+	defer m.Close()
+
+	keys, err := m.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) == 0 {
+		t.Fatal("expected at least the current namespace")
+	}
+	if len(m.Namespaces()) != len(keys) {
+		t.Errorf("expected %d cached namespaces, got %v", len(keys), m.Namespaces())
+	}
+	if len(m.unique) != len(keys) {
+		t.Errorf("expected %d distinct namespaces, got %d", len(keys), len(m.unique))
+	}
+}
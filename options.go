@@ -2,7 +2,9 @@
 
 import (
 	"bytes"
+	"fmt"
 	"net"
+	"time"
 )
 
 // CreateOptions is the options struct for creating a new ipset
@@ -11,16 +13,22 @@ type CreateOptions struct {
 	Protocol uint8
 	Size     uint32 // size/hashsize
 
+	MaxElements uint32 // maxelem of hash types
+
 	Replace  bool // replace existing ipset
 	Timeout  uint32
+	TTL      time.Duration // timeout as a duration, takes precedence over Timeout
 	Counters bool
 	Comments bool
 	Skbinfo  bool
+	ForceAdd bool
 
 	Revision uint8
 	IPFrom   net.IP
 	IPTo     net.IP
-	NetMask  uint32
+	NetMask  uint32 // netmask of hash:ip and hash:net,net, in bits
+	BitMask  net.IP // bitmask of hash:ip and hash:net,net, exclusive with NetMask
+	MarkMask uint32 // markmask of hash:ip,mark
 	PortFrom uint16
 	PortTo   uint16
 }
@@ -58,5 +66,109 @@ func (opts *CreateOptions) CadtFlags() uint32 {
 	if opts.Skbinfo {
 		cadtFlags |= IPSET_FLAG_WITH_SKBINFO
 	}
+	if opts.ForceAdd {
+		cadtFlags |= IPSET_FLAG_WITH_FORCEADD
+	}
 	return cadtFlags
 }
+
+// noRevision marks a mask no revision of a type supports.
+const noRevision = 0xff
+
+// maskRevisions holds the oldest revisions of the types supporting netmask
+// and bitmask.
+var maskRevisions = map[string]struct{ netmask, bitmask uint8 }{
+	TypeHashIP:     {netmask: 0, bitmask: 6},
+	TypeHashNetNet: {netmask: 4, bitmask: 4},
+	TypeBitmapIP:   {netmask: 0, bitmask: noRevision},
+}
+
+// fillMasks validates NetMask and BitMask against the family and the type,
+// and raises the revision to the oldest one supporting them unless a
+// revision was requested.
+func (opt *CreateOptions) fillMasks(typename string, requested uint8) error {
+	if opt.NetMask == 0 && opt.BitMask == nil {
+		return nil
+	}
+	revisions, ok := maskRevisions[typename]
+	if !ok {
+		return fmt.Errorf("netmask and bitmask cannot be used with type %s", typename)
+	}
+	if opt.NetMask != 0 && opt.BitMask != nil {
+		return fmt.Errorf("netmask and bitmask are mutually exclusive")
+	}
+
+	min := revisions.netmask
+	if opt.NetMask != 0 {
+		bits := uint32(8 * net.IPv4len)
+		if opt.Family == FamilyIPV6 {
+			bits = 8 * net.IPv6len
+		}
+		if opt.NetMask > bits {
+			return fmt.Errorf("netmask %d is invalid for family %s", opt.NetMask, FamilyName(opt.Family))
+		}
+	} else {
+		min = revisions.bitmask
+		if min == noRevision {
+			return fmt.Errorf("bitmask cannot be used with type %s", typename)
+		}
+		mask := opt.BitMask.To4()
+		if opt.Family == FamilyIPV6 {
+			mask = opt.BitMask.To16()
+			if opt.BitMask.To4() != nil {
+				mask = nil
+			}
+		}
+		if mask == nil {
+			return fmt.Errorf("bitmask %s is invalid for family %s", opt.BitMask, FamilyName(opt.Family))
+		}
+		if mask.IsUnspecified() {
+			return fmt.Errorf("bitmask %s is empty", opt.BitMask)
+		}
+		opt.BitMask = mask
+	}
+
+	switch {
+	case requested != 0 && requested >= min:
+		opt.Revision = requested
+	case requested != 0:
+		return fmt.Errorf("revision %d of %s does not support netmask or bitmask, %d required", requested, typename, min)
+	case opt.Revision < min:
+		opt.Revision = min
+	}
+	return nil
+}
+
+// CreateOptions returns the options the set was created with, so that
+// Create makes a set with the same header.
+func (s *Sets) CreateOptions() CreateOptions {
+	opts := CreateOptions{
+		Family:      s.Family,
+		Revision:    s.Revision,
+		MaxElements: s.MaxElements,
+		Counters:    s.CadtFlags&IPSET_FLAG_WITH_COUNTERS != 0,
+		Comments:    s.CadtFlags&IPSET_FLAG_WITH_COMMENT != 0,
+		Skbinfo:     s.CadtFlags&IPSET_FLAG_WITH_SKBINFO != 0,
+		ForceAdd:    s.CadtFlags&IPSET_FLAG_WITH_FORCEADD != 0,
+		IPFrom:      s.IPFrom,
+		IPTo:        s.IPTo,
+		NetMask:     uint32(s.NetMask),
+		BitMask:     s.BitMask,
+		MarkMask:    s.MarkMask,
+		PortFrom:    s.PortFrom,
+		PortTo:      s.PortTo,
+	}
+	switch TypeName(s.TypeName).Method() {
+	case "hash":
+		opts.Size = s.HashSize
+	case "list":
+		opts.Size = s.Size
+	}
+	if s.Timeout != nil {
+		opts.Timeout = *s.Timeout
+	}
+	if s.TTL != nil {
+		opts.TTL = *s.TTL
+	}
+	return opts
+}
@@ -0,0 +1,76 @@
+package ipset
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestFillMasks(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		typename string
+		opts     CreateOptions
+		revision uint8
+		valid    bool
+	}{
+		{"netmask", TypeHashIP, CreateOptions{NetMask: 24}, 0, true},
+		{"netmask6", TypeHashIP, CreateOptions{Family: FamilyIPV6, NetMask: 64}, 0, true},
+		{"netmask too long", TypeHashIP, CreateOptions{NetMask: 33}, 0, false},
+		{"bitmask", TypeHashIP, CreateOptions{BitMask: net.ParseIP("255.255.0.255")}, 6, true},
+		{"bitmask6", TypeHashIP, CreateOptions{Family: FamilyIPV6, BitMask: net.ParseIP("ffff:ffff::")}, 6, true},
+		{"bitmask family", TypeHashIP, CreateOptions{Family: FamilyIPV6, BitMask: net.ParseIP("255.255.255.0")}, 0, false},
+		{"bitmask empty", TypeHashIP, CreateOptions{BitMask: net.IPv4zero}, 0, false},
+		{"both", TypeHashIP, CreateOptions{NetMask: 24, BitMask: net.ParseIP("255.255.255.0")}, 0, false},
+		{"net,net", TypeHashNetNet, CreateOptions{NetMask: 16}, 4, true},
+		{"net,net old revision", TypeHashNetNet, CreateOptions{Revision: 3, NetMask: 16}, 0, false},
+		{"old revision", TypeHashIP, CreateOptions{Revision: 4, BitMask: net.ParseIP("255.255.255.0")}, 0, false},
+		{"type", TypeHashNet, CreateOptions{NetMask: 24}, 0, false},
+		{"bitmap bitmask", TypeBitmapIP, CreateOptions{BitMask: net.ParseIP("255.255.255.0")}, 0, false},
+	} {
+		opts := tc.opts
+		requested := opts.Revision
+		opts.fillWithDefault(tc.typename)
+		err := opts.fillMasks(tc.typename, requested)
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+			continue
+		}
+		if tc.valid && opts.Revision != tc.revision {
+			t.Errorf("%s: expected revision %d, got %d", tc.name, tc.revision, opts.Revision)
+		}
+	}
+}
+
+func TestSetsCreateOptions(t *testing.T) {
+	timeout := uint32(60)
+	set := &Sets{
+		TypeName:    TypeHashIP,
+		Family:      FamilyIPV6,
+		Revision:    6,
+		HashSize:    2048,
+		MaxElements: 4096,
+		NetMask:     64,
+		Timeout:     &timeout,
+		CadtFlags:   IPSET_FLAG_WITH_COUNTERS | IPSET_FLAG_WITH_COMMENT,
+	}
+	opts := set.CreateOptions()
+	expected := CreateOptions{
+		Family:      FamilyIPV6,
+		Revision:    6,
+		Size:        2048,
+		MaxElements: 4096,
+		NetMask:     64,
+		Timeout:     60,
+		Counters:    true,
+		Comments:    true,
+	}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Errorf("expected %+v, got %+v", expected, opts)
+	}
+
+	set = &Sets{TypeName: TypeListSet, Size: 8}
+	if opts := set.CreateOptions(); opts.Size != 8 {
+		t.Errorf("expected size 8, got %d", opts.Size)
+	}
+}
@@ -17,4 +17,10 @@
 	ProtocolUDP = uint16(unix.IPPROTO_UDP)
 	// ProtocolSCTP represents SCTP protocol.
 	ProtocolSCTP = uint16(unix.IPPROTO_SCTP)
+	// ProtocolUDPLite represents UDPLite protocol.
+	ProtocolUDPLite = uint16(unix.IPPROTO_UDPLITE)
+	// ProtocolICMP represents ICMP protocol.
+	ProtocolICMP = uint16(unix.IPPROTO_ICMP)
+	// ProtocolICMPv6 represents ICMPv6 protocol.
+	ProtocolICMPv6 = uint16(unix.IPPROTO_ICMPV6)
 )
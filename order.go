@@ -23,6 +23,12 @@ func htons(val uint16) []byte {
 	return bytes
 }
 
+func htonll(val uint64) []byte {
+	bytes := make([]byte, 8)
+	networkOrder.PutUint64(bytes, val)
+	return bytes
+}
+
 func ntohl(buf []byte) uint32 {
 	return networkOrder.Uint32(buf)
 }
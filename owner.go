@@ -0,0 +1,120 @@
+package ipset
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrEmptyPrefix is returned by NewOwner for an empty prefix, which would own
+// every set on the host.
+var ErrEmptyPrefix = errors.New("ipset: owner prefix is empty")
+
+// Owner creates sets labelled with a name prefix, so that several
+// controllers can share a host, and garbage-collects the ones no longer
+// wanted. The kernel keeps no comment on a set, so the prefix is the label.
+type Owner struct {
+	h      *Handle
+	prefix string
+}
+
+// GCResult reports what Owner.GC did.
+type GCResult struct {
+	Destroyed []string
+	Skipped   []GCSkip
+}
+
+// GCSkip is an owned set GC did not destroy.
+type GCSkip struct {
+	SetName string
+	Reason  string
+	Err     error // ErrBusy or the error of Destroy, if any
+}
+
+// NewOwner returns an Owner of the sets named prefix+name. A nil h uses the
+// package handle.
+func NewOwner(h *Handle, prefix string) (*Owner, error) {
+	if prefix == "" {
+		return nil, ErrEmptyPrefix
+	}
+	if h == nil {
+		h = pkgHandle
+	}
+	return &Owner{h: h, prefix: prefix}, nil
+}
+
+// SetName returns the name of the owned set name.
+func (o *Owner) SetName(name string) string {
+	return o.prefix + name
+}
+
+// Owns reports whether setname is owned.
+func (o *Owner) Owns(setname string) bool {
+	return strings.HasPrefix(setname, o.prefix) && len(setname) > len(o.prefix)
+}
+
+// Create creates the owned set name.
+func (o *Owner) Create(name, typename string, options CreateOptions) error {
+	setname := o.SetName(name)
+	if len(setname) >= IPSET_MAXNAMELEN {
+		return fmt.Errorf("set name %q is longer than %d characters", setname, IPSET_MAXNAMELEN-1)
+	}
+	return o.h.Create(setname, typename, options)
+}
+
+// List dumps the owned sets.
+func (o *Owner) List() ([]Sets, error) {
+	all, err := o.h.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	owned := all[:0]
+	for _, s := range all {
+		if o.Owns(s.SetName) {
+			owned = append(owned, s)
+		}
+	}
+	return owned, nil
+}
+
+// GC destroys the owned sets whose names, without the prefix, are not in
+// desired. Sets that are referenced by iptables rules or list:set sets, or
+// that the kernel reports busy, are skipped. list:set sets go first, so
+// that the sets they hold are released.
+func (o *Owner) GC(desired []string) (*GCResult, error) {
+	keep := make(map[string]bool, len(desired))
+	for _, name := range desired {
+		keep[o.SetName(name)] = true
+	}
+
+	result := &GCResult{}
+	for _, lists := range []bool{true, false} {
+		owned, err := o.List()
+		if err != nil {
+			return result, err
+		}
+		for i := range owned {
+			s := &owned[i]
+			if keep[s.SetName] || (s.TypeName == TypeListSet) != lists {
+				continue
+			}
+			if s.References > 0 {
+				result.Skipped = append(result.Skipped, GCSkip{
+					SetName: s.SetName,
+					Reason:  fmt.Sprintf("referenced %d times", s.References),
+				})
+				continue
+			}
+			if err := o.h.Destroy(s.SetName); err != nil {
+				reason := "destroy failed"
+				if err == ErrBusy {
+					reason = "busy"
+				}
+				result.Skipped = append(result.Skipped, GCSkip{SetName: s.SetName, Reason: reason, Err: err})
+				continue
+			}
+			result.Destroyed = append(result.Destroyed, s.SetName)
+		}
+	}
+	return result, nil
+}
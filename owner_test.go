@@ -0,0 +1,22 @@
+package ipset
+
+import "testing"
+
+func TestNewOwner(t *testing.T) {
+	if _, err := NewOwner(nil, ""); err != ErrEmptyPrefix {
+		t.Fatalf("expected ErrEmptyPrefix, got %v", err)
+	}
+
+	o, err := NewOwner(nil, "ctl-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.SetName("web") != "ctl-web" {
+		t.Errorf("unexpected set name %q", o.SetName("web"))
+	}
+	for setname, owned := range map[string]bool{"ctl-web": true, "ctl-": false, "web": false} {
+		if o.Owns(setname) != owned {
+			t.Errorf("Owns(%q): expected %v", setname, owned)
+		}
+	}
+}
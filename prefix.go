@@ -0,0 +1,174 @@
+package ipset
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+)
+
+// addrRange is the addresses from through to, of the same family.
+type addrRange struct {
+	from, to netip.Addr
+}
+
+// prefixRange returns the addresses of p.
+func prefixRange(p netip.Prefix) addrRange {
+	p = p.Masked()
+	last := p.Addr().AsSlice()
+	bits := p.Bits()
+	for i := range last {
+		if host := bits - 8*i; host < 8 {
+			if host < 0 {
+				host = 0
+			}
+			last[i] |= 0xff >> host
+		}
+	}
+	to, _ := netip.AddrFromSlice(last)
+	return addrRange{p.Addr(), to}
+}
+
+// prefixes returns the shortest list of prefixes covering exactly r. Like
+// libipset, the whole address space is covered by its two halves, as a /0
+// cannot be stored: CIDR 0 means a host.
+func (r addrRange) prefixes() []netip.Prefix {
+	var result []netip.Prefix
+	from := r.from
+	for from.IsValid() && from.Compare(r.to) <= 0 {
+		// the largest prefix starting at from and ending before r.to
+		bits := from.BitLen()
+		for bits > 1 {
+			p := netip.PrefixFrom(from, bits-1)
+			if p.Masked().Addr() != from || prefixRange(p).to.Compare(r.to) > 0 {
+				break
+			}
+			bits--
+		}
+		p := netip.PrefixFrom(from, bits)
+		result = append(result, p)
+		from = prefixRange(p).to.Next()
+	}
+	return result
+}
+
+// ranges is a sorted list of disjoint, non adjacent ranges.
+type ranges []addrRange
+
+// normalize sorts rs and merges overlapping and adjacent ranges.
+func normalize(rs []addrRange) ranges {
+	if len(rs) == 0 {
+		return nil
+	}
+	sorted := append([]addrRange(nil), rs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].from.Less(sorted[j].from) })
+
+	result := ranges{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &result[len(result)-1]
+		next := last.to.Next()
+		if r.from.BitLen() == last.to.BitLen() && (r.from.Compare(last.to) <= 0 || r.from == next) {
+			if r.to.Compare(last.to) > 0 {
+				last.to = r.to
+			}
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+func (rs ranges) union(other ranges) ranges {
+	return normalize(append(append([]addrRange(nil), rs...), other...))
+}
+
+func (rs ranges) intersect(other ranges) ranges {
+	var result ranges
+	i, j := 0, 0
+	for i < len(rs) && j < len(other) {
+		a, b := rs[i], other[j]
+		from, to := a.from, a.to
+		if b.from.Compare(from) > 0 {
+			from = b.from
+		}
+		if b.to.Compare(to) < 0 {
+			to = b.to
+		}
+		if from.BitLen() == to.BitLen() && from.Compare(to) <= 0 {
+			result = append(result, addrRange{from, to})
+		}
+		if a.to.Compare(b.to) < 0 {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+func (rs ranges) subtract(other ranges) ranges {
+	var result ranges
+	j := 0
+	for _, r := range rs {
+		for j < len(other) && other[j].to.Compare(r.from) < 0 {
+			j++
+		}
+		from := r.from
+		for k := j; k < len(other) && other[k].from.Compare(r.to) <= 0; k++ {
+			o := other[k]
+			if o.from.Compare(from) > 0 {
+				result = append(result, addrRange{from, o.from.Prev()})
+			}
+			if o.to.Compare(r.to) >= 0 {
+				from = netip.Addr{}
+				break
+			}
+			if o.to.Compare(from) >= 0 {
+				from = o.to.Next()
+			}
+		}
+		if from.IsValid() {
+			result = append(result, addrRange{from, r.to})
+		}
+	}
+	return result
+}
+
+func (rs ranges) prefixes() []netip.Prefix {
+	var result []netip.Prefix
+	for _, r := range rs {
+		result = append(result, r.prefixes()...)
+	}
+	return result
+}
+
+// toAddr converts ip to a netip.Addr, IPv4 addresses in their 4-byte form.
+func toAddr(ip net.IP) (netip.Addr, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	return addr.Unmap(), ok
+}
+
+// entryRange returns the addresses of the first ip or net component of e.
+// A zero CIDR stands for a host.
+func entryRange(e *Entry) (addrRange, bool) {
+	from, ok := toAddr(e.IP)
+	if !ok {
+		return addrRange{}, false
+	}
+	if e.IPTo != nil {
+		to, ok := toAddr(e.IPTo)
+		if !ok || to.BitLen() != from.BitLen() || to.Less(from) {
+			return addrRange{}, false
+		}
+		return addrRange{from, to}, true
+	}
+	bits := int(e.CIDR)
+	if bits == 0 || bits > from.BitLen() {
+		bits = from.BitLen()
+	}
+	return prefixRange(netip.PrefixFrom(from, bits)), true
+}
+
+// prefixEntry returns an entry of the network p.
+func prefixEntry(p netip.Prefix) Entry {
+	return Entry{IP: net.IP(p.Addr().AsSlice()), CIDR: uint8(p.Bits())}
+}
@@ -0,0 +1,65 @@
+package ipset
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	s := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		s[i] = p.String()
+	}
+	return s
+}
+
+func TestRangePrefixes(t *testing.T) {
+	for _, tc := range []struct {
+		from, to string
+		expected []string
+	}{
+		{"10.0.0.1", "10.0.0.6", []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"10.0.0.0", "10.0.0.255", []string{"10.0.0.0/24"}},
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/1", "128.0.0.0/1"}},
+		{"0.0.0.0", "127.255.255.255", []string{"0.0.0.0/1"}},
+		{"255.255.255.254", "255.255.255.255", []string{"255.255.255.254/31"}},
+		{"2001:db8::", "2001:db8::1:0", []string{"2001:db8::/112", "2001:db8::1:0/128"}},
+	} {
+		r := addrRange{netip.MustParseAddr(tc.from), netip.MustParseAddr(tc.to)}
+		if got := prefixStrings(r.prefixes()); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s-%s: expected %v, got %v", tc.from, tc.to, tc.expected, got)
+		}
+	}
+}
+
+func TestRangesOperations(t *testing.T) {
+	parse := func(prefixes ...string) ranges {
+		var rs []addrRange
+		for _, p := range prefixes {
+			rs = append(rs, prefixRange(netip.MustParsePrefix(p)))
+		}
+		return normalize(rs)
+	}
+
+	a := parse("10.0.0.0/24", "10.0.1.0/24", "192.168.0.0/16")
+	if got := prefixStrings(a.prefixes()); !reflect.DeepEqual(got, []string{"10.0.0.0/23", "192.168.0.0/16"}) {
+		t.Errorf("unexpected normalized ranges %v", got)
+	}
+
+	b := parse("10.0.0.128/25", "192.168.1.0/24", "2001:db8::/32")
+	for _, tc := range []struct {
+		name     string
+		result   ranges
+		expected []string
+	}{
+		{"union", a.union(b), []string{"10.0.0.0/23", "192.168.0.0/16", "2001:db8::/32"}},
+		{"intersect", a.intersect(b), []string{"10.0.0.128/25", "192.168.1.0/24"}},
+		{"subtract", a.subtract(b), []string{"10.0.0.0/25", "10.0.1.0/24", "192.168.0.0/24", "192.168.2.0/23", "192.168.4.0/22", "192.168.8.0/21", "192.168.16.0/20", "192.168.32.0/19", "192.168.64.0/18", "192.168.128.0/17"}},
+		{"subtract all", b.subtract(parse("0.0.0.0/0", "::/0")), nil},
+	} {
+		if got := prefixStrings(tc.result.prefixes()); !reflect.DeepEqual(got, tc.expected) && !(len(got) == 0 && tc.expected == nil) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+}
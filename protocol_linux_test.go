@@ -0,0 +1,225 @@
+package ipset
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// protocolCorpus lists the sets captured in testdata/protocol. Each case
+// has four files: the create and add requests, the list response and the
+// XML rendering of the decoded response. Regenerate them as root with
+//
+//	go test -run TestProtocolCorpus -update
+//
+// Types the capturing kernel lacked have no files and are skipped.
+var protocolCorpus = []struct {
+	name     string
+	typename string
+	options  CreateOptions
+	entry    []string
+}{
+	{"hash_ip", TypeHashIP, CreateOptions{Timeout: 3600, Comments: true, Counters: true}, []string{"10.0.0.1", "comment", "corpus"}},
+	{"hash_ip6", TypeHashIP, CreateOptions{Family: FamilyIPV6, NetMask: 64}, []string{"2001:db8:1::"}},
+	{"hash_ip_mark", TypeHashIPMark, CreateOptions{MarkMask: 0xff00}, []string{"10.0.0.2,0x00000100"}},
+	{"hash_ip_port", TypeHashIPPort, CreateOptions{}, []string{"10.0.0.3,tcp:80"}},
+	{"hash_ip_port_ip", TypeHashIPPortIP, CreateOptions{}, []string{"10.0.0.4,udp:53,10.0.1.4"}},
+	{"hash_ip_port_net", TypeHashIPPortNet, CreateOptions{}, []string{"10.0.0.5,tcp:443,10.1.0.0/16"}},
+	{"hash_mac", TypeHashMac, CreateOptions{}, []string{"de:ad:00:00:be:ef"}},
+	{"hash_ip_mac", TypeHashIPMac, CreateOptions{}, []string{"10.0.0.6,de:ad:00:00:be:ef"}},
+	{"hash_net", TypeHashNet, CreateOptions{}, []string{"10.2.0.0/16", "nomatch"}},
+	{"hash_net6", TypeHashNet, CreateOptions{Family: FamilyIPV6}, []string{"2001:db8::/32"}},
+	{"hash_net_net", TypeHashNetNet, CreateOptions{}, []string{"10.3.0.0/24,10.4.0.0/24"}},
+	{"hash_net_port", TypeHashNetPort, CreateOptions{Skbinfo: true}, []string{"10.5.0.0/24,tcp:22", "skbmark", "0x10"}},
+	{"hash_net_port_net", TypeHashNetPortNet, CreateOptions{}, []string{"10.6.0.0/24,udp:123,10.7.0.0/24"}},
+	{"hash_net_iface", TypeHashNetIface, CreateOptions{}, []string{"10.8.0.0/16,eth0"}},
+	{"bitmap_ip", TypeBitmapIP, CreateOptions{IPFrom: net.ParseIP("10.9.0.0"), IPTo: net.ParseIP("10.9.255.255")}, []string{"10.9.1.1"}},
+	{"bitmap_ip_mac", TypeBitmapIPMac, CreateOptions{IPFrom: net.ParseIP("192.168.0.0"), IPTo: net.ParseIP("192.168.0.255")}, []string{"192.168.0.1,de:ad:00:00:be:ef"}},
+	{"bitmap_port", TypeBitmapPort, CreateOptions{PortFrom: 0, PortTo: 1023, Counters: true}, []string{"22"}},
+	{"hash_ip_bitmask", TypeHashIP, CreateOptions{BitMask: net.ParseIP("255.255.0.255")}, []string{"10.0.0.7"}},
+	// last, it refers to the first set
+	{"list_set", TypeListSet, CreateOptions{}, []string{"corpus-hash_ip"}},
+}
+
+func corpusSetName(name string) string {
+	return "corpus-" + name
+}
+
+func corpusPath(name, ext string) string {
+	return filepath.Join("testdata", "protocol", name+"."+ext)
+}
+
+func TestProtocolCorpusTypes(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, c := range protocolCorpus {
+		covered[c.typename] = true
+	}
+	for typename := range typeRevisionsMap {
+		if !covered[typename] {
+			t.Errorf("type %s is missing from the protocol corpus", typename)
+		}
+	}
+}
+
+func TestProtocolCorpus(t *testing.T) {
+	if *update {
+		updateProtocolCorpus(t)
+	}
+
+	for _, c := range protocolCorpus {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			create, err := ioutil.ReadFile(corpusPath(c.name, "create"))
+			if os.IsNotExist(err) {
+				t.Skipf("%s was not captured, regenerate the corpus with -update on a kernel supporting it", c.typename)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			add, err := ioutil.ReadFile(corpusPath(c.name, "add"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			list, err := ioutil.ReadFile(corpusPath(c.name, "list"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden, err := ioutil.ReadFile(corpusPath(c.name, "xml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entry, err := ParseEntry(c.typename, c.entry...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// speak the protocol of the capture
+			h := &Handle{protocol: uint32(corpusProtocol(create))}
+
+			req, err := h.createRequest(corpusSetName(c.name), c.typename, c.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Serialize()[unix.SizeofNlMsghdr:]; !bytes.Equal(got, create) {
+				t.Errorf("create request differs from the capture:\n%s\nexpected:\n%s",
+					FormatMessage(IPSET_CMD_CREATE, got), FormatMessage(IPSET_CMD_CREATE, create))
+			}
+
+			req, err = h.addDelRequest(IPSET_CMD_ADD, corpusSetName(c.name), entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Serialize()[unix.SizeofNlMsghdr:]; !bytes.Equal(got, add) {
+				t.Errorf("add request differs from the capture:\n%s\nexpected:\n%s",
+					FormatMessage(IPSET_CMD_ADD, got), FormatMessage(IPSET_CMD_ADD, add))
+			}
+
+			set := ipsetUnserialize([][]byte{list})
+			if set.SetName != corpusSetName(c.name) || set.TypeName != c.typename {
+				t.Errorf("unexpected set %s of type %s", set.SetName, set.TypeName)
+			}
+			if len(set.Entries) != 1 {
+				t.Fatalf("expected 1 entry, got %d", len(set.Entries))
+			}
+			if want, got := entry.Elem(c.typename), set.Entries[0].Elem(c.typename); want != got {
+				t.Errorf("expected entry %q, got %q", want, got)
+			}
+
+			var buf bytes.Buffer
+			if err := EncodeXML(&buf, []Sets{set}); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), golden) {
+				t.Errorf("decoded set differs from %s:\n%s", corpusPath(c.name, "xml"), buf.String())
+			}
+		})
+	}
+}
+
+// corpusProtocol returns the protocol version of a captured message.
+func corpusProtocol(msg []byte) uint8 {
+	for attr := range nl.ParseAttributes(msg[4:]) {
+		if attr.Type == IPSET_ATTR_PROTOCOL {
+			return attr.Value[0]
+		}
+	}
+	return IPSET_PROTOCOL
+}
+
+// updateProtocolCorpus captures the corpus from the running kernel. Types
+// the kernel does not support keep their previous capture.
+func updateProtocolCorpus(t *testing.T) {
+	tearDown := setUpNetlinkTest(t)
+	defer tearDown()
+
+	if err := os.MkdirAll(filepath.Join("testdata", "protocol"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var msgs []TraceMessage
+	SetTrace(func(m TraceMessage) { msgs = append(msgs, m) })
+	defer SetTrace(nil)
+
+	var created []string
+	defer func() {
+		for i := len(created) - 1; i >= 0; i-- {
+			Destroy(created[i])
+		}
+	}()
+
+	for _, c := range protocolCorpus {
+		setname := corpusSetName(c.name)
+		entry, err := ParseEntry(c.typename, c.entry...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msgs = msgs[:0]
+		if err := Create(setname, c.typename, c.options); err != nil {
+			t.Logf("%s: %v, keeping the previous capture", c.name, err)
+			continue
+		}
+		created = append(created, setname)
+		if err := Add(setname, entry); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if _, err := List(setname); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		files := make(map[string][]byte)
+		for _, m := range msgs {
+			switch {
+			case m.Err != nil:
+			case m.Request && m.Cmd == IPSET_CMD_CREATE:
+				files["create"] = m.Data
+			case m.Request && m.Cmd == IPSET_CMD_ADD:
+				files["add"] = m.Data
+			case !m.Request && m.Cmd == IPSET_CMD_LIST:
+				if files["list"] != nil {
+					t.Fatalf("%s: the set does not fit a single message", c.name)
+				}
+				files["list"] = m.Data
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := EncodeXML(&buf, []Sets{ipsetUnserialize([][]byte{files["list"]})}); err != nil {
+			t.Fatal(err)
+		}
+		files["xml"] = buf.Bytes()
+
+		for ext, data := range files {
+			if err := ioutil.WriteFile(corpusPath(c.name, ext), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package ipset
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RuleReference is an iptables rule using a set.
+type RuleReference struct {
+	Table string // e.g. "filter"
+	Chain string // e.g. "INPUT"
+	Line  int    // line number in the iptables-save output
+	Rule  string // the rule as saved, e.g. "-A INPUT -m set --match-set foo src -j DROP"
+}
+
+func (r RuleReference) String() string {
+	return fmt.Sprintf("%s/%s: %s", r.Table, r.Chain, r.Rule)
+}
+
+// setOptions are the iptables options taking a set name: the set match and
+// the SET target.
+var setOptions = map[string]bool{
+	"--match-set": true,
+	"--set":       true, // before iptables 1.4.4
+	"--add-set":   true,
+	"--del-set":   true,
+	"--map-set":   true,
+}
+
+// FindRuleReferences parses the output of iptables-save or ip6tables-save
+// and returns the rules using setname with `-m set --match-set` or
+// `-j SET --add-set/--del-set/--map-set`.
+func FindRuleReferences(r io.Reader, setname string) ([]RuleReference, error) {
+	var (
+		refs   []RuleReference
+		table  string
+		lineNo int
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "*"):
+			table = line[1:]
+			continue
+		case !strings.HasPrefix(line, "-A ") && !strings.HasPrefix(line, "-I "):
+			continue
+		}
+
+		args := splitRuleArgs(line)
+		if len(args) < 2 {
+			continue
+		}
+		for i := 2; i+1 < len(args); i++ {
+			if setOptions[args[i]] && args[i+1] == setname {
+				refs = append(refs, RuleReference{Table: table, Chain: args[1], Line: lineNo, Rule: line})
+				break
+			}
+		}
+	}
+	return refs, scanner.Err()
+}
+
+// splitRuleArgs splits a saved rule into arguments, honouring the double
+// quotes and backslash escapes iptables-save uses around comments.
+func splitRuleArgs(line string) []string {
+	var (
+		args    []string
+		current strings.Builder
+		quoted  bool
+		inArg   bool
+	)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && quoted && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case (c == ' ' || c == '\t') && !quoted:
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// InUseError is returned by SafeDestroy for a set that is referenced.
+type InUseError struct {
+	SetName    string
+	References uint32
+	Rules      []RuleReference // the rules found in the supplied iptables-save output
+}
+
+func (e *InUseError) Error() string {
+	msg := fmt.Sprintf("set %s cannot be destroyed: it is referenced %d times", e.SetName, e.References)
+	if len(e.Rules) == 0 {
+		return msg + " (by a list:set set or a rule not supplied)"
+	}
+	rules := make([]string, len(e.Rules))
+	for i, r := range e.Rules {
+		rules[i] = r.String()
+	}
+	return msg + ", by " + strings.Join(rules, "; ")
+}
+
+// Unwrap returns ErrBusy.
+func (e *InUseError) Unwrap() error {
+	return ErrBusy
+}
+
+// References returns how many times setname is referenced by the kernel and
+// the rules using it in rules, the output of iptables-save or
+// ip6tables-save. rules may be nil.
+func (h *Handle) References(setname string, rules io.Reader) (uint32, []RuleReference, error) {
+	set, err := h.List(setname)
+	if err != nil {
+		return 0, nil, err
+	}
+	if rules == nil {
+		return set.References, nil, nil
+	}
+	refs, err := FindRuleReferences(rules, setname)
+	return set.References, refs, err
+}
+
+// SafeDestroy destroys setname unless it is referenced, in which case it
+// returns an *InUseError naming the rules of rules, the output of
+// iptables-save or ip6tables-save, that use it. rules may be nil.
+func (h *Handle) SafeDestroy(setname string, rules io.Reader) error {
+	references, refs, err := h.References(setname, rules)
+	if err != nil {
+		return err
+	}
+	if references == 0 {
+		err = h.Destroy(setname)
+		if !errors.Is(err, ErrBusy) {
+			return err
+		}
+		// referenced since it was listed
+		references = 1
+	}
+	return &InUseError{SetName: setname, References: references, Rules: refs}
+}
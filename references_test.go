@@ -0,0 +1,63 @@
+package ipset
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const iptablesSave = `# Generated by iptables-save v1.8.7 on Mon Jan  2 03:04:05 2023
+*raw
+:PREROUTING ACCEPT [0:0]
+-A PREROUTING -m set --match-set blocked src -j DROP
+COMMIT
+*filter
+:INPUT ACCEPT [0:0]
+:FORWARD DROP [0:0]
+-A INPUT -p tcp -m set ! --match-set allowed src,dst -m comment --comment "not \"blocked\" here" -j REJECT
+-A INPUT -m set --match-set blocked-v6 src -j DROP
+-A FORWARD -p tcp --dport 22 -j SET --add-set blocked src --exist --timeout 60
+-A FORWARD -m comment --comment "--match-set blocked" -j ACCEPT
+COMMIT
+`
+
+func TestFindRuleReferences(t *testing.T) {
+	refs, err := FindRuleReferences(strings.NewReader(iptablesSave), "blocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RuleReference{
+		{Table: "raw", Chain: "PREROUTING", Line: 4, Rule: "-A PREROUTING -m set --match-set blocked src -j DROP"},
+		{Table: "filter", Chain: "FORWARD", Line: 11, Rule: "-A FORWARD -p tcp --dport 22 -j SET --add-set blocked src --exist --timeout 60"},
+	}
+	if !reflect.DeepEqual(refs, expected) {
+		t.Errorf("expected %+v, got %+v", expected, refs)
+	}
+
+	refs, err = FindRuleReferences(strings.NewReader(iptablesSave), "allowed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].Chain != "INPUT" {
+		t.Errorf("unexpected references %+v", refs)
+	}
+}
+
+func TestSplitRuleArgs(t *testing.T) {
+	args := splitRuleArgs(`-A INPUT -m comment --comment "a \"b\" c" -j ACCEPT`)
+	expected := []string{"-A", "INPUT", "-m", "comment", "--comment", `a "b" c`, "-j", "ACCEPT"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %q, got %q", expected, args)
+	}
+}
+
+func TestInUseError(t *testing.T) {
+	err := error(&InUseError{SetName: "blocked", References: 1, Rules: []RuleReference{{Table: "raw", Chain: "PREROUTING", Rule: "-A PREROUTING -m set --match-set blocked src -j DROP"}}})
+	if !errors.Is(err, ErrBusy) {
+		t.Error("expected InUseError to be ErrBusy")
+	}
+	if expected := "set blocked cannot be destroyed: it is referenced 1 times, by raw/PREROUTING: -A PREROUTING -m set --match-set blocked src -j DROP"; err.Error() != expected {
+		t.Errorf("unexpected message %q", err)
+	}
+}
@@ -0,0 +1,205 @@
+package ipset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot is the state of all sets at a point in time.
+type Snapshot struct {
+	Time time.Time `json:"time"`
+	Host string    `json:"host,omitempty"`
+	Sets []Sets    `json:"sets"`
+}
+
+// Snapshot captures the headers and members of all sets.
+func (h *Handle) Snapshot() (*Snapshot, error) {
+	sets, err := h.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	return &Snapshot{Time: time.Now(), Host: host, Sets: sets}, nil
+}
+
+// Set returns the set named name, or nil.
+func (s *Snapshot) Set(name string) *Sets {
+	for i := range s.Sets {
+		if s.Sets[i].SetName == name {
+			return &s.Sets[i]
+		}
+	}
+	return nil
+}
+
+// WriteTo writes the snapshot to w as JSON.
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// Save writes the snapshot to the file at path.
+func (s *Snapshot) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := s.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadSnapshot reads a snapshot written by Snapshot.WriteTo.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// LoadSnapshot reads a snapshot saved by Snapshot.Save.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSnapshot(f)
+}
+
+// SnapshotDiff is the difference between two snapshots.
+type SnapshotDiff struct {
+	Created   []string  // sets only in the newer snapshot
+	Destroyed []string  // sets only in the older snapshot
+	Changed   []SetDiff // sets in both snapshots that differ
+}
+
+// SetDiff is the difference between two versions of a set.
+type SetDiff struct {
+	SetName string
+	Header  []HeaderChange
+	Added   []Entry
+	Removed []Entry
+}
+
+// HeaderChange is a changed header field of a set, e.g. "hashsize".
+// Old or New is empty if the field is missing in one version.
+type HeaderChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+func (c HeaderChange) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Field, c.Old, c.New)
+}
+
+// Empty reports whether the snapshots are identical.
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.Created) == 0 && len(d.Destroyed) == 0 && len(d.Changed) == 0
+}
+
+// Diff compares snapshot a with the newer snapshot b. Members are compared
+// by element only; changed timeouts, counters or comments are ignored.
+func Diff(a, b *Snapshot) *SnapshotDiff {
+	d := &SnapshotDiff{}
+
+	for i := range a.Sets {
+		if b.Set(a.Sets[i].SetName) == nil {
+			d.Destroyed = append(d.Destroyed, a.Sets[i].SetName)
+		}
+	}
+	for i := range b.Sets {
+		newer := &b.Sets[i]
+		older := a.Set(newer.SetName)
+		if older == nil {
+			d.Created = append(d.Created, newer.SetName)
+			continue
+		}
+		if sd := diffSets(older, newer); len(sd.Header)+len(sd.Added)+len(sd.Removed) > 0 {
+			d.Changed = append(d.Changed, sd)
+		}
+	}
+
+	sort.Strings(d.Created)
+	sort.Strings(d.Destroyed)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].SetName < d.Changed[j].SetName })
+	return d
+}
+
+func diffSets(a, b *Sets) SetDiff {
+	d := SetDiff{SetName: b.SetName}
+
+	ha, hb := headerFields(a), headerFields(b)
+	fields := make([]string, 0, len(hb))
+	for k := range ha {
+		fields = append(fields, k)
+	}
+	for k := range hb {
+		if _, ok := ha[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	for _, k := range fields {
+		if ha[k] != hb[k] {
+			d.Header = append(d.Header, HeaderChange{Field: k, Old: ha[k], New: hb[k]})
+		}
+	}
+
+	ea, eb := elements(a), elements(b)
+	for i := range a.Entries {
+		if _, ok := eb[a.Entries[i].Elem(a.TypeName)]; !ok {
+			d.Removed = append(d.Removed, a.Entries[i])
+		}
+	}
+	for i := range b.Entries {
+		if _, ok := ea[b.Entries[i].Elem(b.TypeName)]; !ok {
+			d.Added = append(d.Added, b.Entries[i])
+		}
+	}
+	return d
+}
+
+// headerFields returns the type, revision and header options of a set,
+// with the flags joined into a single "flags" field.
+func headerFields(s *Sets) map[string]string {
+	fields := map[string]string{
+		"type":     s.TypeName,
+		"revision": fmt.Sprint(s.Revision),
+	}
+	var flags []string
+	opts := s.HeaderOptions()
+	for i := 0; i < len(opts); i++ {
+		if isHeaderFlag(opts[i]) {
+			flags = append(flags, opts[i])
+			continue
+		}
+		fields[opts[i]] = opts[i+1]
+		i++
+	}
+	if len(flags) > 0 {
+		fields["flags"] = strings.Join(flags, ",")
+	}
+	return fields
+}
+
+func elements(s *Sets) map[string]struct{} {
+	m := make(map[string]struct{}, len(s.Entries))
+	for i := range s.Entries {
+		m[s.Entries[i].Elem(s.TypeName)] = struct{}{}
+	}
+	return m
+}
@@ -0,0 +1,76 @@
+package ipset
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	older := &Snapshot{Sets: xmlTestSets()}
+	newer := &Snapshot{Sets: xmlTestSets()}
+
+	// destroy "ports", create "extra"
+	newer.Sets = append(newer.Sets[:2], newer.Sets[3], Sets{SetName: "extra", TypeName: TypeHashIP})
+	web := newer.Set("web")
+	web.HashSize = 2048
+	web.CadtFlags |= IPSET_FLAG_WITH_SKBINFO
+	web.Entries = append(web.Entries[1:], Entry{IP: net.ParseIP("10.0.0.3").To4(), Protocol: Uint8Ptr(uint8(ProtocolUDP)), Port: Uint16Ptr(53)})
+	// a changed timeout is not a change of the member
+	web.Entries[0].Timeout = Uint32Ptr(1)
+
+	d := Diff(older, newer)
+	if !reflect.DeepEqual(d.Created, []string{"extra"}) || !reflect.DeepEqual(d.Destroyed, []string{"ports"}) {
+		t.Errorf("unexpected created %v, destroyed %v", d.Created, d.Destroyed)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].SetName != "web" {
+		t.Fatalf("unexpected changes: %+v", d.Changed)
+	}
+	c := d.Changed[0]
+	expected := []HeaderChange{
+		{Field: "flags", Old: "counters,comment", New: "counters,comment,skbinfo"},
+		{Field: "hashsize", Old: "1024", New: "2048"},
+	}
+	if !reflect.DeepEqual(c.Header, expected) {
+		t.Errorf("expected header changes %v, got %v", expected, c.Header)
+	}
+	if len(c.Added) != 1 || c.Added[0].Elem(TypeHashIPPort) != "10.0.0.3,udp:53" {
+		t.Errorf("unexpected added: %+v", c.Added)
+	}
+	if len(c.Removed) != 1 || c.Removed[0].Elem(TypeHashIPPort) != "10.0.0.1,tcp:80" {
+		t.Errorf("unexpected removed: %+v", c.Removed)
+	}
+
+	if d := Diff(older, older); !d.Empty() {
+		t.Errorf("expected no difference, got %+v", d)
+	}
+}
+
+func TestSnapshotSaveLoad(t *testing.T) {
+	s := &Snapshot{Time: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), Host: "fw1", Sets: xmlTestSets()}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Time.Equal(s.Time) || loaded.Host != s.Host {
+		t.Errorf("unexpected snapshot %+v", loaded)
+	}
+	if d := Diff(s, loaded); !d.Empty() {
+		t.Errorf("expected no difference after reload, got %+v", d)
+	}
+
+	var buf bytes.Buffer
+	if _, err := loaded.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,317 @@
+package ipset
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// TraceMessage is a netlink message a Handle sends or receives.
+type TraceMessage struct {
+	Request bool   // sent to the kernel, otherwise received from it
+	Cmd     int    // IPSET_CMD_*
+	Flags   uint16 // netlink flags of a request
+	Data    []byte // the netfilter header and the attributes
+	Err     error  // the error of a failed request, received without data
+}
+
+// String returns the message in the format of FormatMessage, prefixed with
+// its direction.
+func (m TraceMessage) String() string {
+	prefix := "< "
+	if m.Request {
+		prefix = "> "
+	}
+	if m.Err != nil {
+		return fmt.Sprintf("%s%s: %v", prefix, cmdName(m.Cmd), m.Err)
+	}
+	s := FormatMessage(m.Cmd, m.Data)
+	if m.Flags != 0 {
+		s = strings.Replace(s, "\n", " "+formatNetlinkFlags(m.Flags)+"\n", 1)
+	}
+	return prefix + s
+}
+
+var cmdNames = map[int]string{
+	IPSET_CMD_PROTOCOL:    "protocol",
+	IPSET_CMD_CREATE:      "create",
+	IPSET_CMD_DESTROY:     "destroy",
+	IPSET_CMD_FLUSH:       "flush",
+	IPSET_CMD_RENAME:      "rename",
+	IPSET_CMD_SWAP:        "swap",
+	IPSET_CMD_LIST:        "list",
+	IPSET_CMD_SAVE:        "save",
+	IPSET_CMD_ADD:         "add",
+	IPSET_CMD_DEL:         "del",
+	IPSET_CMD_TEST:        "test",
+	IPSET_CMD_HEADER:      "header",
+	IPSET_CMD_TYPE:        "type",
+	IPSET_CMD_GET_BYNAME:  "get_byname",
+	IPSET_CMD_GET_BYINDEX: "get_byindex",
+}
+
+func cmdName(cmd int) string {
+	if name, ok := cmdNames[cmd]; ok {
+		return name
+	}
+	return "cmd " + strconv.Itoa(cmd)
+}
+
+var netlinkFlagNames = []struct {
+	flag uint16
+	name string
+}{
+	{0x1, "request"},
+	{0x2, "multi"},
+	{0x4, "ack"},
+	{0x100, "root/replace"},
+	{0x200, "match"},
+	{0x400, "excl/atomic"},
+	{0x800, "create/append"},
+}
+
+func formatNetlinkFlags(flags uint16) string {
+	var names []string
+	for _, f := range netlinkFlagNames {
+		if flags&f.flag != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return "[" + strings.Join(names, ",") + "]"
+}
+
+// attribute tables of the levels of a message
+var (
+	cmdAttrNames = map[uint16]string{
+		IPSET_ATTR_PROTOCOL:     "protocol",
+		IPSET_ATTR_SETNAME:      "setname",
+		IPSET_ATTR_TYPENAME:     "typename",
+		IPSET_ATTR_REVISION:     "revision",
+		IPSET_ATTR_FAMILY:       "family",
+		IPSET_ATTR_FLAGS:        "flags",
+		IPSET_ATTR_DATA:         "data",
+		IPSET_ATTR_ADT:          "adt",
+		IPSET_ATTR_LINENO:       "lineno",
+		IPSET_ATTR_PROTOCOL_MIN: "protocol_min",
+		IPSET_ATTR_INDEX:        "index",
+	}
+	cadtAttrNames = map[uint16]string{
+		IPSET_ATTR_IP:         "ip",
+		IPSET_ATTR_IP_TO:      "ip_to",
+		IPSET_ATTR_CIDR:       "cidr",
+		IPSET_ATTR_PORT:       "port",
+		IPSET_ATTR_PORT_TO:    "port_to",
+		IPSET_ATTR_TIMEOUT:    "timeout",
+		IPSET_ATTR_PROTO:      "proto",
+		IPSET_ATTR_CADT_FLAGS: "cadt_flags",
+		IPSET_ATTR_LINENO:     "lineno",
+		IPSET_ATTR_MARK:       "mark",
+		IPSET_ATTR_MARKMASK:   "markmask",
+		IPSET_ATTR_BITMASK:    "bitmask",
+	}
+	createAttrNames = map[uint16]string{
+		IPSET_ATTR_INITVAL:    "initval",
+		IPSET_ATTR_HASHSIZE:   "hashsize",
+		IPSET_ATTR_MAXELEM:    "maxelem",
+		IPSET_ATTR_NETMASK:    "netmask",
+		IPSET_ATTR_BUCKETSIZE: "bucketsize",
+		IPSET_ATTR_RESIZE:     "resize",
+		IPSET_ATTR_SIZE:       "size",
+		IPSET_ATTR_ELEMENTS:   "elements",
+		IPSET_ATTR_REFERENCES: "references",
+		IPSET_ATTR_MEMSIZE:    "memsize",
+	}
+	adtAttrNames = map[uint16]string{
+		IPSET_ATTR_ETHER:    "ether",
+		IPSET_ATTR_NAME:     "name",
+		IPSET_ATTR_NAMEREF:  "nameref",
+		IPSET_ATTR_IP2:      "ip2",
+		IPSET_ATTR_CIDR2:    "cidr2",
+		IPSET_ATTR_IP2_TO:   "ip2_to",
+		IPSET_ATTR_IFACE:    "iface",
+		IPSET_ATTR_BYTES:    "bytes",
+		IPSET_ATTR_PACKETS:  "packets",
+		IPSET_ATTR_COMMENT:  "comment",
+		IPSET_ATTR_SKBMARK:  "skbmark",
+		IPSET_ATTR_SKBPRIO:  "skbprio",
+		IPSET_ATTR_SKBQUEUE: "skbqueue",
+	}
+)
+
+// attribute levels
+const (
+	levelCmd = iota
+	levelCreate
+	levelADT
+	levelIP
+)
+
+// stringAttrs are the attributes holding strings, by level.
+var stringAttrs = map[int]map[uint16]bool{
+	levelCmd: {IPSET_ATTR_SETNAME: true, IPSET_ATTR_TYPENAME: true},
+	levelADT: {IPSET_ATTR_NAME: true, IPSET_ATTR_NAMEREF: true, IPSET_ATTR_IFACE: true, IPSET_ATTR_COMMENT: true},
+}
+
+// hexAttrs are the 32-bit attributes of data printed in hexadecimal.
+var hexAttrs = map[uint16]bool{
+	IPSET_ATTR_CADT_FLAGS: true,
+	IPSET_ATTR_MARK:       true,
+	IPSET_ATTR_MARKMASK:   true,
+	IPSET_ATTR_INITVAL:    true,
+}
+
+// ipAttrs are the nested attributes holding an address.
+var ipAttrs = map[uint16]bool{
+	IPSET_ATTR_IP:      true,
+	IPSET_ATTR_IP_TO:   true,
+	IPSET_ATTR_BITMASK: true,
+	IPSET_ATTR_IP2:     true,
+	IPSET_ATTR_IP2_TO:  true,
+}
+
+const (
+	nlaFlagNested    = 0x8000
+	nlaFlagByteOrder = 0x4000
+	nlaTypeMask      = 0x3fff
+)
+
+// FormatMessage decodes a message of the ipset command cmd, its netfilter
+// header followed by its attributes, into readable text: a line with the
+// command and the family, then a line per attribute, nested ones indented.
+func FormatMessage(cmd int, data []byte) string {
+	var b strings.Builder
+	b.WriteString(cmdName(cmd))
+	if len(data) < 4 {
+		b.WriteString(" (truncated)\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, " %s\n", FamilyName(data[0]))
+
+	dataLevel := levelCreate
+	if cmd == IPSET_CMD_ADD || cmd == IPSET_CMD_DEL || cmd == IPSET_CMD_TEST {
+		dataLevel = levelADT
+	}
+	formatAttributes(&b, data[4:], levelCmd, dataLevel, 1)
+	return b.String()
+}
+
+// formatAttributes writes the attributes of data, of level, indented by
+// depth. dataLevel is the level of the data attribute at command level.
+func formatAttributes(b *strings.Builder, data []byte, level, dataLevel, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for len(data) >= 4 {
+		length := int(binary.LittleEndian.Uint16(data))
+		rawType := binary.LittleEndian.Uint16(data[2:])
+		if length < 4 || length > len(data) {
+			fmt.Fprintf(b, "%sinvalid attribute length %d\n", indent, length)
+			return
+		}
+		value := data[4:length]
+		typ := rawType & nlaTypeMask
+		name := attrName(level, typ)
+		if level == levelADT && typ == IPSET_ATTR_DATA && rawType&nlaFlagNested != 0 {
+			// an entry of an adt container, not a proto
+			name = "data"
+		}
+
+		var flags []string
+		if rawType&nlaFlagNested != 0 {
+			flags = append(flags, "nested")
+		}
+		if rawType&nlaFlagByteOrder != 0 {
+			flags = append(flags, "net")
+		}
+		if len(flags) > 0 {
+			name += " (" + strings.Join(flags, ",") + ")"
+		}
+
+		switch {
+		case level == levelCmd && typ == IPSET_ATTR_DATA:
+			fmt.Fprintf(b, "%s%s:\n", indent, name)
+			formatAttributes(b, value, dataLevel, dataLevel, depth+1)
+		case level == levelCmd && typ == IPSET_ATTR_ADT:
+			fmt.Fprintf(b, "%s%s:\n", indent, name)
+			formatAttributes(b, value, levelADT, levelADT, depth+1)
+		case level == levelADT && typ == IPSET_ATTR_DATA && rawType&nlaFlagNested != 0:
+			fmt.Fprintf(b, "%s%s:\n", indent, name)
+			formatAttributes(b, value, levelADT, levelADT, depth+1)
+		case level != levelCmd && ipAttrs[typ] && rawType&nlaFlagNested != 0:
+			fmt.Fprintf(b, "%s%s: %s\n", indent, name, formatIPAttr(value))
+		default:
+			fmt.Fprintf(b, "%s%s: %s\n", indent, name, formatValue(level, typ, rawType, value))
+		}
+
+		aligned := (length + 3) &^ 3
+		if aligned > len(data) {
+			return
+		}
+		data = data[aligned:]
+	}
+}
+
+func attrName(level int, typ uint16) string {
+	var name string
+	switch level {
+	case levelCmd:
+		name = cmdAttrNames[typ]
+	case levelCreate:
+		if name = cadtAttrNames[typ]; name == "" {
+			name = createAttrNames[typ]
+		}
+	case levelADT:
+		if name = cadtAttrNames[typ]; name == "" {
+			name = adtAttrNames[typ]
+		}
+	}
+	if name == "" {
+		name = "attr " + strconv.Itoa(int(typ))
+	}
+	return name
+}
+
+// formatIPAttr decodes the address nested in an ip attribute.
+func formatIPAttr(value []byte) string {
+	if len(value) < 4 {
+		return "(empty)"
+	}
+	length := int(binary.LittleEndian.Uint16(value))
+	if length < 4 || length > len(value) {
+		return fmt.Sprintf("invalid %x", value)
+	}
+	return net.IP(value[4:length]).String()
+}
+
+func formatValue(level int, typ, rawType uint16, value []byte) string {
+	if stringAttrs[level][typ] {
+		return strconv.Quote(strings.TrimRight(string(value), "\x00"))
+	}
+	if level == levelADT && typ == IPSET_ATTR_ETHER && len(value) == 6 {
+		return net.HardwareAddr(value).String()
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if rawType&nlaFlagByteOrder != 0 {
+		order = binary.BigEndian
+	}
+	switch len(value) {
+	case 1:
+		return strconv.Itoa(int(value[0]))
+	case 2:
+		return strconv.Itoa(int(order.Uint16(value)))
+	case 4:
+		v := order.Uint32(value)
+		if level != levelCmd && hexAttrs[typ] {
+			return fmt.Sprintf("0x%08x", v)
+		}
+		return strconv.FormatUint(uint64(v), 10)
+	case 8:
+		if level == levelADT && typ == IPSET_ATTR_SKBMARK {
+			v := order.Uint64(value)
+			return fmt.Sprintf("0x%x/0x%x", v>>32, v&0xffffffff)
+		}
+		return strconv.FormatUint(order.Uint64(value), 10)
+	}
+	return fmt.Sprintf("%x", value)
+}
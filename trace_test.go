@@ -0,0 +1,82 @@
+package ipset
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFormatMessage(t *testing.T) {
+	msg, err := ioutil.ReadFile("testdata/ipset_list_result")
+	if err != nil {
+		t.Fatalf("reading test fixture failed: %v", err)
+	}
+
+	expected := `list inet
+  protocol: 6
+  setname: "clients"
+  typename: "hash:mac"
+  family: 0
+  revision: 0
+  data (nested):
+    hashsize (net): 1024
+    maxelem (net): 65536
+    references (net): 0
+    memsize (net): 496
+    elements (net): 2
+    timeout (net): 3600
+    cadt_flags (net): 0x00000018
+  adt (nested):
+    data (nested):
+      ether: de:ad:00:00:be:ef
+      timeout (net): 3577
+      bytes (net): 4121
+      packets (net): 42
+      comment: "foo bar"
+    data (nested):
+      ether: 01:02:03:00:01:02
+      timeout (net): 2089
+      bytes (net): 50122
+      packets (net): 512
+`
+	if got := FormatMessage(IPSET_CMD_LIST, msg); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestFormatMessageData(t *testing.T) {
+	// an add request of 10.0.0.1,tcp:80 with a line number
+	msg := []byte{
+		2, 0, 0, 0,
+		5, 0, 1, 0, 7, 0, 0, 0, // protocol 7
+		8, 0, 2, 0, 'w', 'e', 'b', 0, // setname
+		52, 0, 7, 0x80, // data
+		12, 0, 1, 0x80, 8, 0, 1, 0x40, 10, 0, 0, 1, // ip
+		6, 0, 4, 0x40, 0, 80, 0, 0, // port
+		5, 0, 7, 0, 6, 0, 0, 0, // proto
+		8, 0, 9, 0x40, 0, 0, 0, 3, // lineno
+		10, 0, 17, 0, 0, 0x11, 0x22, 0x33, 0x44, 0x55, 0, 0, // ether
+	}
+	expected := `add inet
+  protocol: 7
+  setname: "web"
+  data (nested):
+    ip (nested): 10.0.0.1
+    port (net): 80
+    proto: 6
+    lineno (net): 3
+    ether: 00:11:22:33:44:55
+`
+	if got := FormatMessage(IPSET_CMD_ADD, msg); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	m := TraceMessage{Request: true, Cmd: IPSET_CMD_ADD, Flags: 0x5, Data: msg[:20]}
+	if got := m.String(); got != "> add inet [request,ack]\n  protocol: 7\n  setname: \"web\"\n" {
+		t.Errorf("unexpected trace %q", got)
+	}
+	m = TraceMessage{Cmd: IPSET_CMD_DESTROY, Err: errors.New("busy")}
+	if got := m.String(); got != "< destroy: busy" {
+		t.Errorf("unexpected trace %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package ipset
+
+import (
+	"sort"
+	"time"
+)
+
+// MaxTimeout is the longest timeout the kernel accepts.
+const MaxTimeout = 2147483 * time.Second
+
+// TimeoutSeconds converts d to the seconds of a timeout attribute, rounding
+// up and capping at MaxTimeout. Zero means the entry never expires.
+func TimeoutSeconds(d time.Duration) uint32 {
+	if d <= 0 {
+		return 0
+	}
+	if d > MaxTimeout {
+		d = MaxTimeout
+	}
+	return uint32((d + time.Second - 1) / time.Second)
+}
+
+// timeout returns the timeout in seconds to send for the entry, preferring
+// TTL over Timeout.
+func (e *Entry) timeout() *uint32 {
+	if e.TTL != nil {
+		return Uint32Ptr(TimeoutSeconds(*e.TTL))
+	}
+	return e.Timeout
+}
+
+// SetTTL sets the timeout of the entry. A zero ttl adds the entry permanently
+// to a set with timeout support.
+func (e *Entry) SetTTL(ttl time.Duration) {
+	e.TTL = &ttl
+	e.Timeout = Uint32Ptr(TimeoutSeconds(ttl))
+}
+
+// timeout returns the timeout in seconds to create the set with, preferring
+// TTL over Timeout.
+func (opts *CreateOptions) timeout() uint32 {
+	if opts.TTL > 0 {
+		return TimeoutSeconds(opts.TTL)
+	}
+	return opts.Timeout
+}
+
+// SetTTL sets the default timeout of the set to create.
+func (opts *CreateOptions) SetTTL(ttl time.Duration) {
+	opts.TTL = ttl
+	opts.Timeout = TimeoutSeconds(ttl)
+}
+
+// secondsPtr returns the duration of a timeout attribute.
+func secondsPtr(seconds uint32) *time.Duration {
+	d := time.Duration(seconds) * time.Second
+	return &d
+}
+
+// ExpiringWithin returns the entries of the set that expire within window,
+// soonest first. Permanent entries are never returned.
+func (s *Sets) ExpiringWithin(window time.Duration) []Entry {
+	var result []Entry
+	for _, e := range s.Entries {
+		if timeout := e.timeout(); timeout != nil && *timeout > 0 && time.Duration(*timeout)*time.Second <= window {
+			result = append(result, e)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return *result[i].timeout() < *result[j].timeout()
+	})
+	return result
+}
+
+// Find returns the entry of the set with the same element as entry, or nil.
+func (s *Sets) Find(entry *Entry) *Entry {
+	elem := entry.Elem(s.TypeName)
+	for i := range s.Entries {
+		if s.Entries[i].Elem(s.TypeName) == elem {
+			return &s.Entries[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package ipset
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTimeoutSeconds(t *testing.T) {
+	for _, tc := range []struct {
+		d        time.Duration
+		expected uint32
+	}{
+		{0, 0},
+		{-time.Second, 0},
+		{time.Millisecond, 1},
+		{90 * time.Second, 90},
+		{1500 * time.Millisecond, 2},
+		{24 * 30 * time.Hour, 2147483},
+	} {
+		if actual := TimeoutSeconds(tc.d); actual != tc.expected {
+			t.Errorf("TimeoutSeconds(%s): expected %d, got %d", tc.d, tc.expected, actual)
+		}
+	}
+}
+
+func TestExpiringWithin(t *testing.T) {
+	set := Sets{
+		TypeName: TypeHashIP,
+		Entries: []Entry{
+			{IP: net.ParseIP("10.0.0.1").To4(), Timeout: Uint32Ptr(300)},
+			{IP: net.ParseIP("10.0.0.2").To4(), Timeout: Uint32Ptr(30)},
+			{IP: net.ParseIP("10.0.0.3").To4(), Timeout: Uint32Ptr(0)},
+			{IP: net.ParseIP("10.0.0.4").To4()},
+			{IP: net.ParseIP("10.0.0.5").To4(), Timeout: Uint32Ptr(60)},
+		},
+	}
+
+	expiring := set.ExpiringWithin(time.Minute)
+	if len(expiring) != 2 || !expiring[0].IP.Equal(net.ParseIP("10.0.0.2")) || !expiring[1].IP.Equal(net.ParseIP("10.0.0.5")) {
+		t.Errorf("unexpected entries: %+v", expiring)
+	}
+
+	if e := set.Find(&Entry{IP: net.ParseIP("10.0.0.4").To4()}); e != &set.Entries[3] {
+		t.Errorf("expected to find 10.0.0.4, got %+v", e)
+	}
+	if e := set.Find(&Entry{IP: net.ParseIP("10.0.0.9").To4()}); e != nil {
+		t.Errorf("expected no entry, got %+v", e)
+	}
+}
+
+func TestEntryTTL(t *testing.T) {
+	var e Entry
+	if e.timeout() != nil {
+		t.Error("expected no timeout")
+	}
+	e.Timeout = Uint32Ptr(10)
+	ttl := 90 * time.Second
+	e.TTL = &ttl
+	if timeout := e.timeout(); timeout == nil || *timeout != 90 {
+		t.Errorf("expected TTL to take precedence, got %v", timeout)
+	}
+
+	opts := CreateOptions{Timeout: 10, TTL: time.Hour}
+	if timeout := opts.timeout(); timeout != 3600 {
+		t.Errorf("expected TTL to take precedence, got %d", timeout)
+	}
+}
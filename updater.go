@@ -0,0 +1,269 @@
+package ipset
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrUpdaterClosed is returned when an intent is queued on a closed Updater.
+var ErrUpdaterClosed = errors.New("ipset: updater closed")
+
+// UpdaterOptions configures an Updater.
+type UpdaterOptions struct {
+	// BatchSize triggers a flush once this many entries are pending.
+	// Defaults to 256.
+	BatchSize int
+	// Interval is the longest time an intent stays pending. Defaults to
+	// 100ms.
+	Interval time.Duration
+	// ErrorBuffer is the capacity of the Errors channel. Errors are dropped
+	// while it is full. Defaults to 16.
+	ErrorBuffer int
+}
+
+// UpdateError reports a batch the kernel refused.
+type UpdateError struct {
+	SetName string
+	Cmd     string // "add" or "del"
+	Entries []*Entry
+	Err     error
+}
+
+func (e *UpdateError) Error() string {
+	return fmt.Sprintf("ipset %s %s: %d entries: %v", e.Cmd, e.SetName, len(e.Entries), e.Err)
+}
+
+func (e *UpdateError) Unwrap() error {
+	return e.Err
+}
+
+type batcher interface {
+	AddBatch(setname string, entries []*Entry) error
+	DelBatch(setname string, entries []*Entry) error
+}
+
+type updateKey struct {
+	setname string
+	elem    string
+}
+
+type updateIntent struct {
+	del   bool
+	entry *Entry
+}
+
+// Updater queues Add and Del intents from many goroutines and applies them
+// asynchronously in batches. Intents on the same entry are coalesced: only
+// the last one is applied.
+type Updater struct {
+	h    batcher
+	opts UpdaterOptions
+
+	mu      sync.Mutex
+	pending map[updateKey]updateIntent
+	order   []updateKey
+	closed  bool
+
+	flushMu sync.Mutex
+	trigger chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	errs    chan error
+}
+
+// NewUpdater returns an Updater applying intents through h. Close must be
+// called to release it. Full hash sets grow according to the GrowPolicy of
+// h.
+func NewUpdater(h *Handle, opts UpdaterOptions) *Updater {
+	return newUpdater(h, opts)
+}
+
+func newUpdater(h batcher, opts UpdaterOptions) *Updater {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 100 * time.Millisecond
+	}
+	if opts.ErrorBuffer <= 0 {
+		opts.ErrorBuffer = 16
+	}
+
+	u := &Updater{
+		h:       h,
+		opts:    opts,
+		pending: make(map[updateKey]updateIntent),
+		trigger: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		errs:    make(chan error, opts.ErrorBuffer),
+	}
+	go u.run()
+	return u
+}
+
+// Add queues the addition of entry to setname.
+func (u *Updater) Add(setname string, entry *Entry) error {
+	return u.queue(setname, updateIntent{entry: entry})
+}
+
+// Del queues the deletion of entry from setname.
+func (u *Updater) Del(setname string, entry *Entry) error {
+	return u.queue(setname, updateIntent{del: true, entry: entry})
+}
+
+// Errors returns the channel flush errors are reported on, as *UpdateError.
+func (u *Updater) Errors() <-chan error {
+	return u.errs
+}
+
+// Flush applies all pending intents and returns the first error.
+func (u *Updater) Flush() error {
+	return u.flush()
+}
+
+// Close applies all pending intents and stops the Updater. The Errors
+// channel is closed once the final flush is done.
+func (u *Updater) Close() error {
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		return nil
+	}
+	u.closed = true
+	u.mu.Unlock()
+
+	close(u.done)
+	<-u.stopped
+	err := u.flush()
+	close(u.errs)
+	return err
+}
+
+func (u *Updater) queue(setname string, intent updateIntent) error {
+	// the flush goroutine reads the entry, keep it away from the caller
+	entry := *intent.entry
+	intent.entry = &entry
+	key := updateKey{setname: setname, elem: entry.key()}
+
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		return ErrUpdaterClosed
+	}
+	if _, ok := u.pending[key]; !ok {
+		u.order = append(u.order, key)
+	}
+	u.pending[key] = intent
+	full := len(u.pending) >= u.opts.BatchSize
+	u.mu.Unlock()
+
+	if full {
+		select {
+		case u.trigger <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (u *Updater) run() {
+	defer close(u.stopped)
+
+	ticker := time.NewTicker(u.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-u.done:
+			return
+		case <-ticker.C:
+		case <-u.trigger:
+		}
+		u.flush()
+	}
+}
+
+func (u *Updater) flush() error {
+	u.flushMu.Lock()
+	defer u.flushMu.Unlock()
+
+	u.mu.Lock()
+	pending, order := u.pending, u.order
+	u.pending, u.order = make(map[updateKey]updateIntent), nil
+	u.mu.Unlock()
+
+	var (
+		setnames []string
+		adds     = make(map[string][]*Entry)
+		dels     = make(map[string][]*Entry)
+		seen     = make(map[string]bool)
+	)
+	for _, key := range order {
+		if !seen[key.setname] {
+			seen[key.setname] = true
+			setnames = append(setnames, key.setname)
+		}
+		intent := pending[key]
+		if intent.del {
+			dels[key.setname] = append(dels[key.setname], intent.entry)
+		} else {
+			adds[key.setname] = append(adds[key.setname], intent.entry)
+		}
+	}
+
+	var first error
+	for _, setname := range setnames {
+		for _, batch := range []struct {
+			cmd     string
+			entries []*Entry
+			apply   func(string, []*Entry) error
+		}{
+			{"del", dels[setname], u.h.DelBatch},
+			{"add", adds[setname], u.h.AddBatch},
+		} {
+			for len(batch.entries) > 0 {
+				n := len(batch.entries)
+				if n > u.opts.BatchSize {
+					n = u.opts.BatchSize
+				}
+				chunk := batch.entries[:n]
+				batch.entries = batch.entries[n:]
+
+				if err := batch.apply(setname, chunk); err != nil {
+					uerr := &UpdateError{SetName: setname, Cmd: batch.cmd, Entries: chunk, Err: err}
+					if first == nil {
+						first = uerr
+					}
+					select {
+					case u.errs <- uerr:
+					default:
+					}
+				}
+			}
+		}
+	}
+	return first
+}
+
+// key identifies the element of the entry, ignoring its options.
+func (e *Entry) key() string {
+	proto, port, portTo, mark := int64(-1), int64(-1), int64(-1), int64(-1)
+	if e.Protocol != nil {
+		proto = int64(*e.Protocol)
+	}
+	if e.Port != nil {
+		port = int64(*e.Port)
+	}
+	if e.PortTo != nil {
+		portTo = int64(*e.PortTo)
+	}
+	if e.Mark != nil {
+		mark = int64(*e.Mark)
+	}
+	return fmt.Sprintf("%s|%x/%d|%x|%x/%d|%s|%s|%d|%d|%d|%d",
+		e.Name, []byte(e.IP.To16()), e.CIDR, []byte(e.IPTo.To16()), []byte(e.IP2.To16()), e.CIDR2,
+		e.MAC, e.IFace, proto, port, portTo, mark)
+}
@@ -0,0 +1,159 @@
+package ipset
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeBatcher struct {
+	mu      sync.Mutex
+	batches []string
+	entries map[string]int
+	fail    error
+}
+
+func (f *fakeBatcher) apply(cmd, setname string, entries []*Entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail != nil {
+		return f.fail
+	}
+	f.batches = append(f.batches, cmd+" "+setname)
+	for _, e := range entries {
+		if cmd == "add" {
+			f.entries[setname+" "+e.IP.String()]++
+		} else {
+			delete(f.entries, setname+" "+e.IP.String())
+		}
+	}
+	return nil
+}
+
+func (f *fakeBatcher) AddBatch(setname string, entries []*Entry) error {
+	return f.apply("add", setname, entries)
+}
+
+func (f *fakeBatcher) DelBatch(setname string, entries []*Entry) error {
+	return f.apply("del", setname, entries)
+}
+
+func ipEntry(i int) *Entry {
+	return &Entry{IP: net.IPv4(10, 0, byte(i>>8), byte(i)).To4()}
+}
+
+func TestUpdaterCoalesce(t *testing.T) {
+	f := &fakeBatcher{entries: make(map[string]int)}
+	u := newUpdater(f, UpdaterOptions{Interval: time.Hour})
+
+	u.Add("a", ipEntry(1))
+	u.Add("a", ipEntry(1))
+	u.Add("a", ipEntry(2))
+	u.Del("a", ipEntry(2))
+	u.Del("b", ipEntry(3))
+	u.Add("b", ipEntry(3))
+	if err := u.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.entries) != 2 || f.entries["a 10.0.0.1"] != 1 || f.entries["b 10.0.0.3"] != 1 {
+		t.Errorf("unexpected entries: %v", f.entries)
+	}
+	expected := []string{"del a", "add a", "add b"}
+	if len(f.batches) != len(expected) {
+		t.Fatalf("expected batches %v, got %v", expected, f.batches)
+	}
+	for i := range expected {
+		if f.batches[i] != expected[i] {
+			t.Errorf("expected batches %v, got %v", expected, f.batches)
+		}
+	}
+	if err := u.Add("a", ipEntry(1)); err != ErrUpdaterClosed {
+		t.Errorf("expected ErrUpdaterClosed, got %v", err)
+	}
+}
+
+func TestUpdaterCopiesEntry(t *testing.T) {
+	f := &fakeBatcher{entries: make(map[string]int)}
+	u := newUpdater(f, UpdaterOptions{Interval: time.Hour})
+
+	entry := ipEntry(1)
+	u.Add("a", entry)
+	entry.IP = net.ParseIP("10.0.0.9").To4()
+	if err := u.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.entries) != 1 || f.entries["a 10.0.0.1"] != 1 {
+		t.Errorf("unexpected entries: %v", f.entries)
+	}
+}
+
+func TestUpdaterTriggers(t *testing.T) {
+	f := &fakeBatcher{entries: make(map[string]int)}
+	u := newUpdater(f, UpdaterOptions{BatchSize: 10, Interval: time.Hour})
+	defer u.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				u.Add("a", ipEntry(g*5+i))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	waitFor(t, func() bool { return len(f.snapshot()) >= 10 })
+
+	f2 := &fakeBatcher{entries: make(map[string]int)}
+	u2 := newUpdater(f2, UpdaterOptions{Interval: 10 * time.Millisecond})
+	defer u2.Close()
+	u2.Add("a", ipEntry(1))
+	waitFor(t, func() bool { return len(f2.snapshot()) == 1 })
+}
+
+func TestUpdaterErrors(t *testing.T) {
+	f := &fakeBatcher{entries: make(map[string]int), fail: ErrSetNotExist}
+	u := newUpdater(f, UpdaterOptions{Interval: 10 * time.Millisecond})
+	u.Add("missing", ipEntry(1))
+
+	select {
+	case err := <-u.Errors():
+		var uerr *UpdateError
+		if !errors.As(err, &uerr) || uerr.SetName != "missing" || uerr.Cmd != "add" || !errors.Is(err, ErrSetNotExist) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error")
+	}
+
+	u.Close()
+	if _, ok := <-u.Errors(); ok {
+		t.Error("expected errors channel to be closed")
+	}
+}
+
+func (f *fakeBatcher) snapshot() map[string]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m := make(map[string]int, len(f.entries))
+	for k, v := range f.entries {
+		m[k] = v
+	}
+	return m
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
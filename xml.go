@@ -0,0 +1,280 @@
+package ipset
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// EncodeXML writes sets in the format of `ipset list -output xml`.
+func EncodeXML(w io.Writer, sets []Sets) error {
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString("<ipsets>\n")
+	for i := range sets {
+		s := &sets[i]
+		fmt.Fprintf(bw, "<ipset name=\"%s\">\n", xmlEscape(s.SetName))
+		fmt.Fprintf(bw, "<type>%s</type>\n", xmlEscape(s.TypeName))
+		fmt.Fprintf(bw, "<revision>%d</revision>\n", s.Revision)
+
+		bw.WriteString("<header>\n")
+		header := s.HeaderOptions()
+		for j := 0; j < len(header); j++ {
+			name := header[j]
+			if isHeaderFlag(name) {
+				fmt.Fprintf(bw, "<%s/>\n", name)
+				continue
+			}
+			j++
+			fmt.Fprintf(bw, "<%s>%s</%s>\n", name, xmlEscape(header[j]), name)
+		}
+		if s.BucketSize != 0 {
+			fmt.Fprintf(bw, "<bucketsize>%d</bucketsize>\n", s.BucketSize)
+			fmt.Fprintf(bw, "<initval>0x%08x</initval>\n", s.InitVal)
+		}
+		fmt.Fprintf(bw, "<memsize>%d</memsize>\n", s.SizeInMemory)
+		fmt.Fprintf(bw, "<references>%d</references>\n", s.References)
+		fmt.Fprintf(bw, "<numentries>%d</numentries>\n", s.NumEntries)
+		bw.WriteString("</header>\n")
+
+		bw.WriteString("<members>\n")
+		for j := range s.Entries {
+			writeXMLMember(bw, s.TypeName, &s.Entries[j])
+		}
+		bw.WriteString("</members>\n")
+		bw.WriteString("</ipset>\n")
+	}
+	bw.WriteString("</ipsets>\n")
+
+	return bw.Flush()
+}
+
+func writeXMLMember(w *bufio.Writer, typename string, e *Entry) {
+	fmt.Fprintf(w, "<member><elem>%s</elem>", xmlEscape(e.Elem(typename)))
+
+	opts := e.Options()
+	for i := 0; i < len(opts); i++ {
+		name := opts[i]
+		if name == "nomatch" {
+			fmt.Fprintf(w, "<%s/>", name)
+			continue
+		}
+		i++
+		fmt.Fprintf(w, "<%s>%s</%s>", name, xmlEscape(opts[i]), name)
+	}
+	w.WriteString("</member>\n")
+}
+
+func isHeaderFlag(name string) bool {
+	for _, f := range cadtFlagNames {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func xmlEscape(s string) string {
+	return xmlEscaper.Replace(s)
+}
+
+type xmlIPSets struct {
+	XMLName xml.Name   `xml:"ipsets"`
+	Sets    []xmlIPSet `xml:"ipset"`
+}
+
+type xmlIPSet struct {
+	Name     string      `xml:"name,attr"`
+	Type     string      `xml:"type"`
+	Revision uint8       `xml:"revision"`
+	Header   xmlHeader   `xml:"header"`
+	Members  []xmlMember `xml:"members>member"`
+}
+
+type xmlHeader struct {
+	Family     string    `xml:"family"`
+	Range      string    `xml:"range"`
+	HashSize   uint32    `xml:"hashsize"`
+	MaxElem    uint32    `xml:"maxelem"`
+	BucketSize uint8     `xml:"bucketsize"`
+	InitVal    string    `xml:"initval"`
+	NetMask    uint8     `xml:"netmask"`
+	BitMask    string    `xml:"bitmask"`
+	Size       uint32    `xml:"size"`
+	MarkMask   string    `xml:"markmask"`
+	Timeout    *uint32   `xml:"timeout"`
+	Counters   *struct{} `xml:"counters"`
+	Comment    *struct{} `xml:"comment"`
+	Skbinfo    *struct{} `xml:"skbinfo"`
+	ForceAdd   *struct{} `xml:"forceadd"`
+	MemSize    uint32    `xml:"memsize"`
+	References uint32    `xml:"references"`
+	NumEntries uint32    `xml:"numentries"`
+}
+
+type xmlMember struct {
+	Elem     string    `xml:"elem"`
+	Timeout  string    `xml:"timeout"`
+	Packets  string    `xml:"packets"`
+	Bytes    string    `xml:"bytes"`
+	Comment  *string   `xml:"comment"`
+	SkbMark  string    `xml:"skbmark"`
+	SkbPrio  string    `xml:"skbprio"`
+	SkbQueue string    `xml:"skbqueue"`
+	NoMatch  *struct{} `xml:"nomatch"`
+}
+
+// DecodeXML reads sets in the format of `ipset list -output xml`.
+func DecodeXML(r io.Reader) ([]Sets, error) {
+	var doc xmlIPSets
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	result := make([]Sets, len(doc.Sets))
+	for i := range doc.Sets {
+		if err := result[i].fromXML(&doc.Sets[i]); err != nil {
+			return nil, fmt.Errorf("ipset %q: %w", doc.Sets[i].Name, err)
+		}
+	}
+	return result, nil
+}
+
+func (s *Sets) fromXML(v *xmlIPSet) error {
+	h := &v.Header
+	*s = Sets{
+		SetName:      v.Name,
+		TypeName:     v.Type,
+		Revision:     v.Revision,
+		HashSize:     h.HashSize,
+		MaxElements:  h.MaxElem,
+		BucketSize:   h.BucketSize,
+		NetMask:      h.NetMask,
+		Size:         h.Size,
+		Timeout:      h.Timeout,
+		SizeInMemory: h.MemSize,
+		References:   h.References,
+		NumEntries:   h.NumEntries,
+	}
+
+	if h.Family != "" {
+		family, err := ParseFamily(h.Family)
+		if err != nil {
+			return err
+		}
+		s.Family = family
+	}
+	if h.BitMask != "" {
+		if s.BitMask = parseIP(h.BitMask); s.BitMask == nil {
+			return fmt.Errorf("invalid bitmask: %q", h.BitMask)
+		}
+	}
+	if h.MarkMask != "" {
+		v, err := strconv.ParseUint(h.MarkMask, 0, 32)
+		if err != nil {
+			return fmt.Errorf("invalid markmask: %q", h.MarkMask)
+		}
+		s.MarkMask = uint32(v)
+	}
+	if h.InitVal != "" {
+		v, err := strconv.ParseUint(h.InitVal, 0, 32)
+		if err != nil {
+			return fmt.Errorf("invalid initval: %q", h.InitVal)
+		}
+		s.InitVal = uint32(v)
+	}
+	if h.Range != "" {
+		if err := s.parseRange(h.Range); err != nil {
+			return err
+		}
+	}
+	if h.Counters != nil {
+		s.CadtFlags |= IPSET_FLAG_WITH_COUNTERS
+	}
+	if h.Comment != nil {
+		s.CadtFlags |= IPSET_FLAG_WITH_COMMENT
+	}
+	if h.Skbinfo != nil {
+		s.CadtFlags |= IPSET_FLAG_WITH_SKBINFO
+	}
+	if h.ForceAdd != nil {
+		s.CadtFlags |= IPSET_FLAG_WITH_FORCEADD
+	}
+
+	if len(v.Members) > 0 {
+		s.Entries = make([]Entry, 0, len(v.Members))
+	}
+	for i := range v.Members {
+		m := &v.Members[i]
+		args := []string{m.Elem}
+		for _, opt := range []struct{ name, value string }{
+			{"timeout", m.Timeout},
+			{"packets", m.Packets},
+			{"bytes", m.Bytes},
+			{"skbmark", m.SkbMark},
+			{"skbprio", m.SkbPrio},
+			{"skbqueue", m.SkbQueue},
+		} {
+			if opt.value != "" {
+				args = append(args, opt.name, strings.TrimSpace(opt.value))
+			}
+		}
+		if m.Comment != nil {
+			args = append(args, "comment", unquoteComment(*m.Comment))
+		}
+		if m.NoMatch != nil {
+			args = append(args, "nomatch")
+		}
+
+		entry, err := ParseEntry(s.TypeName, args...)
+		if err != nil {
+			return err
+		}
+		s.Entries = append(s.Entries, *entry)
+	}
+	return nil
+}
+
+// unquoteComment strips the quotes ipset prints around comments.
+func unquoteComment(s string) string {
+	if v, err := strconv.Unquote(s); err == nil {
+		return v
+	}
+	return strings.Trim(s, "\"")
+}
+
+// parseRange parses the "range" header option of bitmap types.
+func (s *Sets) parseRange(value string) error {
+	idx := strings.IndexByte(value, '-')
+	if idx < 0 {
+		return fmt.Errorf("invalid range: %q", value)
+	}
+	from, to := value[:idx], value[idx+1:]
+
+	if s.TypeName == TypeBitmapPort {
+		pf, err := strconv.ParseUint(from, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid range: %q", value)
+		}
+		pt, err := strconv.ParseUint(to, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid range: %q", value)
+		}
+		s.PortFrom, s.PortTo = uint16(pf), uint16(pt)
+		return nil
+	}
+
+	s.IPFrom, s.IPTo = parseIP(from), parseIP(to)
+	if s.IPFrom == nil || s.IPTo == nil {
+		return fmt.Errorf("invalid range: %q", value)
+	}
+	if ip4 := s.IPFrom.To4(); ip4 != nil {
+		s.IPFrom, s.IPTo = ip4, s.IPTo.To4()
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package ipset
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func xmlTestSets() []Sets {
+	timeout := uint32(300)
+	packets, bytes := uint64(3), uint64(180)
+	return []Sets{
+		{
+			SetName:      "web",
+			TypeName:     TypeHashIPPort,
+			Revision:     6,
+			Family:       FamilyIPV4,
+			HashSize:     1024,
+			MaxElements:  65536,
+			BucketSize:   12,
+			InitVal:      0x5a8d1a4e,
+			Timeout:      &timeout,
+			CadtFlags:    IPSET_FLAG_WITH_COUNTERS | IPSET_FLAG_WITH_COMMENT,
+			SizeInMemory: 408,
+			NumEntries:   2,
+			Entries: []Entry{
+				{IP: net.ParseIP("10.0.0.1").To4(), Protocol: Uint8Ptr(uint8(ProtocolTCP)), Port: Uint16Ptr(80), Timeout: Uint32Ptr(120), Packets: &packets, Bytes: &bytes, Comment: "a <b> & c"},
+				{IP: net.ParseIP("10.0.0.2").To4(), Protocol: Uint8Ptr(uint8(ProtocolICMP)), Port: Uint16Ptr(ICMPTypeCode(8, 0)), Timeout: Uint32Ptr(60), Packets: new(uint64), Bytes: new(uint64)},
+			},
+		},
+		{
+			SetName:      "nets6",
+			TypeName:     TypeHashNet,
+			Revision:     7,
+			Family:       FamilyIPV6,
+			HashSize:     1024,
+			MaxElements:  65536,
+			BucketSize:   12,
+			InitVal:      0x1e2f6c07,
+			CadtFlags:    IPSET_FLAG_WITH_SKBINFO,
+			SizeInMemory: 1304,
+			References:   1,
+			NumEntries:   2,
+			Entries: []Entry{
+				{IP: net.ParseIP("2001:db8::"), CIDR: 32, SkbMark: Uint32Ptr(0x10), SkbMask: Uint32Ptr(0xffffffff)},
+				{IP: net.ParseIP("2001:db8:1::"), CIDR: 48, NoMatch: true},
+			},
+		},
+		{
+			SetName:      "ports",
+			TypeName:     TypeBitmapPort,
+			Revision:     3,
+			PortFrom:     1,
+			PortTo:       1024,
+			SizeInMemory: 264,
+			NumEntries:   1,
+			Entries: []Entry{
+				{Port: Uint16Ptr(22)},
+			},
+		},
+		{
+			SetName:      "all",
+			TypeName:     TypeListSet,
+			Revision:     3,
+			Size:         8,
+			SizeInMemory: 104,
+			NumEntries:   2,
+			Entries: []Entry{
+				{Name: "web"},
+				{Name: "nets6"},
+			},
+		},
+	}
+}
+
+func TestEncodeXML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeXML(&buf, xmlTestSets()); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := "testdata/ipset_list.xml"
+	if *update {
+		if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("output differs from %s:\n%s", golden, buf.String())
+	}
+}
+
+func TestDecodeXML(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/ipset_list.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets, err := DecodeXML(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := xmlTestSets()
+	if len(sets) != len(expected) {
+		t.Fatalf("expected %d sets, got %d", len(expected), len(sets))
+	}
+	for i := range expected {
+		e, s := expected[i], sets[i]
+		if !reflect.DeepEqual(e.HeaderOptions(), s.HeaderOptions()) {
+			t.Errorf("%s: expected header %v, got %v", e.SetName, e.HeaderOptions(), s.HeaderOptions())
+		}
+		if e.SetName != s.SetName || e.Revision != s.Revision || e.SizeInMemory != s.SizeInMemory ||
+			e.References != s.References || e.NumEntries != s.NumEntries ||
+			e.BucketSize != s.BucketSize || e.InitVal != s.InitVal {
+			t.Errorf("%s: unexpected set %+v", e.SetName, s)
+		}
+		if len(e.Entries) != len(s.Entries) {
+			t.Fatalf("%s: expected %d entries, got %d", e.SetName, len(e.Entries), len(s.Entries))
+		}
+		for j := range e.Entries {
+			if want, got := e.Entries[j].Format(e.TypeName), s.Entries[j].Format(e.TypeName); want != got {
+				t.Errorf("%s: expected entry %q, got %q", e.SetName, want, got)
+			}
+		}
+	}
+
+	if _, err := DecodeXML(strings.NewReader(`<ipsets><ipset name="x"><type>hash:ip</type><members><member><elem>bogus</elem></member></members></ipset></ipsets>`)); err == nil {
+		t.Error("expected invalid member to be rejected")
+	}
+}